@@ -2,17 +2,40 @@ package badgerdb
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger"
 	"github.com/renproject/kv/db"
 )
 
+// reserved is the prefix of the reserved key-space of the DB, and reservedEnd
+// is the smallest key that is greater than all keys in it.
+var (
+	reserved    = []byte(db.ReservedPrefix)
+	reservedEnd = prefixEnd(reserved)
+)
+
 // badgerDB is a badgerDB implementation of the `db.Iterable`.
 type badgerDB struct {
 	db    *badger.DB
 	codec db.Codec
+
+	// The garbage collector of the value log is stopped, and waited for,
+	// before the DB is closed, because badger crashes when garbage is
+	// collected from a closed DB.
+	stopOnce sync.Once
+	stop     chan struct{}
+	stopped  chan struct{}
+
+	// closeMu is held for reading while badger is used, and for writing while
+	// it is closed, because badger crashes when it is used during, or after,
+	// being closed. Using the DB after it has been closed returns
+	// `db.ErrClosed` instead.
+	closeMu sync.RWMutex
+	closed  bool
 }
 
 // New returns a new `db.Iterable`.
@@ -28,8 +51,10 @@ func New(path string, codec db.Codec) db.DB {
 	}
 
 	bdb := &badgerDB{
-		db:    db,
-		codec: codec,
+		db:      db,
+		codec:   codec,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
 	}
 
 	go bdb.gc()
@@ -39,15 +64,315 @@ func New(path string, codec db.Codec) db.DB {
 
 // Close implements the `db.DB` interface.
 func (bdb *badgerDB) Close() error {
+	bdb.stopOnce.Do(func() { close(bdb.stop) })
+	<-bdb.stopped
+
+	bdb.closeMu.Lock()
+	defer bdb.closeMu.Unlock()
+	if bdb.closed {
+		return nil
+	}
+	bdb.closed = true
 	return bdb.db.Close()
 }
 
+// use locks the DB so that it is not closed until the returned function is
+// called. It returns `db.ErrClosed` if the DB has already been closed. The lock
+// is not reentrant, so functions that use the DB must not call each other.
+func (bdb *badgerDB) use() (func(), error) {
+	bdb.closeMu.RLock()
+	if bdb.closed {
+		bdb.closeMu.RUnlock()
+		return nil, db.ErrClosed
+	}
+	return bdb.closeMu.RUnlock, nil
+}
+
+// Codec implements the `db.DB` interface.
+func (bdb *badgerDB) Codec() db.Codec {
+	return bdb.codec
+}
+
 // Insert implements the `db.DB` interface.
 func (bdb *badgerDB) Insert(key string, value interface{}) error {
+	return bdb.InsertContext(context.Background(), key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (bdb *badgerDB) Get(key string, value interface{}) error {
+	return bdb.GetContext(context.Background(), key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (bdb *badgerDB) Delete(key string) error {
+	return bdb.DeleteContext(context.Background(), key)
+}
+
+// Has implements the `db.DB` interface. Getting an item from badger does not
+// read its value, so only the key is looked up.
+func (bdb *badgerDB) Has(key string) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	release, err := bdb.use()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	err = bdb.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(key))
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, convertErr(err)
+}
+
+// InsertIfAbsent implements the `db.DB` interface.
+func (bdb *badgerDB) InsertIfAbsent(key string, value interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
 	data, err := bdb.codec.Encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	return bdb.update(func(txn *badger.Txn) (bool, error) {
+		_, err := txn.Get([]byte(key))
+		if err != badger.ErrKeyNotFound {
+			return false, err
+		}
+		return true, txn.Set([]byte(key), data)
+	})
+}
+
+// DeleteIfEquals implements the `db.DB` interface.
+func (bdb *badgerDB) DeleteIfEquals(key string, value interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	return bdb.update(func(txn *badger.Txn) (bool, error) {
+		if ok, err := bdb.equals(txn, key, value); !ok || err != nil {
+			return false, err
+		}
+		return true, txn.Delete([]byte(key))
+	})
+}
+
+// CompareAndSwap implements the `db.DB` interface.
+func (bdb *badgerDB) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	data, err := bdb.codec.Encode(new)
+	if err != nil {
+		return false, err
+	}
+
+	return bdb.update(func(txn *badger.Txn) (bool, error) {
+		if ok, err := bdb.equals(txn, key, old); !ok || err != nil {
+			return false, err
+		}
+		return true, txn.Set([]byte(key), data)
+	})
+}
+
+// Merge implements the `db.DB` interface. Values are merged in a read/write
+// transaction, which is retried on conflicts, instead of using the merge
+// operator returned by GetMergeOperator. The merge operator stores each value
+// as a separate version of the key, which Get, Size and Iterator would observe
+// without merging. It is also bound to a single key and merge function, and
+// merges in a goroutine that must be stopped, so it would need an operator for
+// every key that is merged.
+func (bdb *badgerDB) Merge(key, name string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	_, err := bdb.update(func(txn *badger.Txn) (bool, error) {
+		var existing []byte
+		item, err := txn.Get([]byte(key))
+		switch err {
+		case nil:
+			if existing, err = item.ValueCopy(nil); err != nil {
+				return false, err
+			}
+		case badger.ErrKeyNotFound:
+		default:
+			return false, err
+		}
+
+		data, err := db.MergeValue(bdb.codec, name, existing, value)
+		if err != nil {
+			return false, err
+		}
+		return true, txn.Set([]byte(key), data)
+	})
+	return err
+}
+
+// DeletePrefix implements the `db.DB` interface. Badger blocks all writes while
+// the prefix is being dropped, so writes to any key that happen at the same
+// time fail with an error instead of waiting. They are not retried, because
+// badger returns the same error for writes after the DB is closed. Prefixes
+// that hide the reserved key-space, such as the empty prefix, cannot be
+// dropped without dropping the reserved key-space, so their keys are deleted
+// one at a time instead, which does not block other writes.
+func (bdb *badgerDB) DeletePrefix(prefix string) error {
+	release, err := bdb.use()
 	if err != nil {
 		return err
 	}
+	defer release()
+
+	if db.HidesReserved(prefix) {
+		return bdb.deleteKeys(prefix)
+	}
+	return convertErr(bdb.db.DropPrefix([]byte(prefix)))
+}
+
+// deleteKeys deletes the keys that begin with the prefix, except for the keys
+// in the reserved key-space. The keys are deleted using a write batch, which
+// splits the deletes across as many transactions as needed.
+func (bdb *badgerDB) deleteKeys(prefix string) error {
+	wb := bdb.db.NewWriteBatch()
+	err := bdb.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if bytes.HasPrefix(key, reserved) {
+				continue
+			}
+			if err := wb.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		wb.Cancel()
+		return convertErr(err)
+	}
+	return convertErr(wb.Flush())
+}
+
+// update runs the function in a read/write transaction, and retries it when
+// the transaction conflicts with another write. It returns the result of the
+// function in the transaction that was committed.
+func (bdb *badgerDB) update(f func(txn *badger.Txn) (bool, error)) (bool, error) {
+	release, err := bdb.use()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	for {
+		ok := false
+		err := bdb.db.Update(func(txn *badger.Txn) error {
+			var err error
+			ok, err = f(txn)
+			return err
+		})
+		if err == badger.ErrConflict {
+			continue
+		}
+		return ok, convertErr(err)
+	}
+}
+
+// equals returns whether the value associated with the key in the transaction
+// is equal to the given value.
+func (bdb *badgerDB) equals(txn *badger.Txn, key string, value interface{}) (bool, error) {
+	item, err := txn.Get([]byte(key))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return false, err
+	}
+	return db.EqualValue(bdb.codec, data, value)
+}
+
+// Size implements the `db.DB` interface.
+func (bdb *badgerDB) Size(prefix string) (int, error) {
+	return bdb.SizeContext(context.Background(), prefix)
+}
+
+// Stats implements the `db.DB` interface. Badger only reports the size of the
+// LSM tree and value log for the whole DB, so the disk bytes are estimated
+// from the size that badger estimates for each key/value pair. Values are not
+// read while iterating.
+func (bdb *badgerDB) Stats(prefix string) (db.Stats, error) {
+	release, err := bdb.use()
+	if err != nil {
+		return db.Stats{}, err
+	}
+	defer release()
+
+	stats := db.Stats{}
+	err = bdb.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		hidden := db.HidesReserved(prefix)
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if hidden && bytes.HasPrefix(item.Key(), reserved) {
+				continue
+			}
+			stats.Keys++
+			stats.KeyBytes += item.KeySize()
+			stats.ValueBytes += item.ValueSize()
+			stats.DiskBytes += item.EstimatedSize()
+		}
+		return nil
+	})
+	if err != nil {
+		return db.Stats{}, convertErr(err)
+	}
+	return stats, nil
+}
+
+// Iterator implements the `db.DB` interface.
+func (bdb *badgerDB) Iterator(prefix string) db.Iterator {
+	return bdb.IteratorContext(context.Background(), prefix, db.IteratorOptions{})
+}
+
+// IteratorWithOptions implements the `db.DB` interface.
+func (bdb *badgerDB) IteratorWithOptions(prefix string, opts db.IteratorOptions) db.Iterator {
+	return bdb.IteratorContext(context.Background(), prefix, opts)
+}
+
+// InsertContext implements the `db.DB` interface.
+func (bdb *badgerDB) InsertContext(ctx context.Context, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := bdb.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	release, err := bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
 
 	err = bdb.db.Update(func(txn *badger.Txn) error {
 		return txn.Set([]byte(key), data)
@@ -55,12 +380,21 @@ func (bdb *badgerDB) Insert(key string, value interface{}) error {
 	return convertErr(err)
 }
 
-// Get implements the `db.DB` interface.
-func (bdb *badgerDB) Get(key string, value interface{}) error {
+// GetContext implements the `db.DB` interface.
+func (bdb *badgerDB) GetContext(ctx context.Context, key string, value interface{}) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
-	err := bdb.db.View(func(txn *badger.Txn) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	release, err := bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = bdb.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get([]byte(key))
 		if err != nil {
 			return err
@@ -75,113 +409,550 @@ func (bdb *badgerDB) Get(key string, value interface{}) error {
 	return convertErr(err)
 }
 
-// Delete implements the `db.DB` interface.
-func (bdb *badgerDB) Delete(key string) error {
+// DeleteContext implements the `db.DB` interface.
+func (bdb *badgerDB) DeleteContext(ctx context.Context, key string) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
-	err := bdb.db.Update(func(txn *badger.Txn) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	release, err := bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = bdb.db.Update(func(txn *badger.Txn) error {
 		return txn.Delete([]byte(key))
 	})
 	return convertErr(err)
 }
 
-// Size implements the `db.DB` interface.
-func (bdb *badgerDB) Size(prefix string) (int, error) {
+// SizeContext implements the `db.DB` interface.
+func (bdb *badgerDB) SizeContext(ctx context.Context, prefix string) (int, error) {
+	release, err := bdb.use()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
 	count := 0
-	err := bdb.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.Prefix = []byte(prefix)
-		it := txn.NewIterator(opts)
-		defer it.Close()
-		for it.Rewind(); it.Valid(); it.Next() {
-			count++
-		}
-		return nil
+	err = bdb.db.View(func(txn *badger.Txn) error {
+		var err error
+		count, err = size(ctx, txn, prefix)
+		return err
 	})
 	return count, err
 }
 
-// Iterator implements the `db.DB` interface.
-func (bdb *badgerDB) Iterator(prefix string) db.Iterator {
+// IteratorContext implements the `db.DB` interface.
+func (bdb *badgerDB) IteratorContext(ctx context.Context, prefix string, opts db.IteratorOptions) db.Iterator {
+	release, err := bdb.use()
+	if err != nil {
+		return newClosedIterator(err)
+	}
+	defer release()
+
 	tx := bdb.db.NewTransaction(false)
+	iter := newIterator(ctx, bdb, tx, prefix, opts)
+	iter.discard = true
+	return iter
+}
+
+// InsertRaw implements the `db.DB` interface.
+func (bdb *badgerDB) InsertRaw(key string, data []byte) error {
+	release, err := bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = bdb.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), data)
+	})
+	return convertErr(err)
+}
+
+// GetRaw implements the `db.DB` interface.
+func (bdb *badgerDB) GetRaw(key string) ([]byte, error) {
+	if key == "" {
+		return nil, db.ErrEmptyKey
+	}
+	release, err := bdb.use()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var data []byte
+	err = bdb.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	return data, convertErr(err)
+}
+
+// NewBatch implements the `db.DB` interface.
+func (bdb *badgerDB) NewBatch() db.Batch {
+	return &batch{
+		bdb: bdb,
+	}
+}
+
+// NewTxn implements the `db.DB` interface.
+func (bdb *badgerDB) NewTxn() (db.Txn, error) {
+	release, err := bdb.use()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return &txn{
+		bdb: bdb,
+		tx:  bdb.db.NewTransaction(true),
+	}, nil
+}
+
+// Snapshot implements the `db.DB` interface.
+func (bdb *badgerDB) Snapshot() (db.Snapshot, error) {
+	release, err := bdb.use()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return &snapshot{
+		bdb: bdb,
+		tx:  bdb.db.NewTransaction(false),
+	}, nil
+}
+
+// size returns the number of key/value pairs in the transaction where the key
+// begins with the given prefix. It stops counting once the context is done.
+func size(ctx context.Context, txn *badger.Txn, prefix string) (int, error) {
 	opts := badger.DefaultIteratorOptions
 	opts.Prefix = []byte(prefix)
-	iter := tx.NewIterator(opts)
-	iter.Rewind()
-	return &iterator{
-		prefix:      []byte(prefix),
-		initialized: false,
-		tx:          tx,
-		iter:        iter,
-		codec:       bdb.codec,
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	hidden := db.HidesReserved(prefix)
+	count := 0
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if hidden && bytes.HasPrefix(it.Item().Key(), reserved) {
+			continue
+		}
+		count++
 	}
+	return count, nil
 }
 
 func (bdb *badgerDB) gc() {
+	defer close(bdb.stopped)
+
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
-	for range ticker.C {
-		err := bdb.db.RunValueLogGC(0.5)
-		if err != nil {
+	for {
+		select {
+		case <-bdb.stop:
 			return
+		case <-ticker.C:
+			err := bdb.db.RunValueLogGC(0.5)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// newIterator returns an iterator over the key/value pairs in the transaction
+// where the key begins with the prefix, and is in the range of the options.
+// The transaction is not discarded when the iterator is closed, and the iterator
+// stops once the context is done. The DB must be in use by the caller.
+func newIterator(ctx context.Context, bdb *badgerDB, tx *badger.Txn, prefix string, opts db.IteratorOptions) *iterator {
+	// The bounds of the iterator are checked by the iterator itself, instead of
+	// using the prefix option of badger, because a reverse badger iterator
+	// cannot seek to the end of a prefix.
+	lower := []byte(prefix + opts.Start)
+	upper := prefixEnd([]byte(prefix))
+	if opts.End != "" {
+		upper = []byte(prefix + opts.End)
+	}
+
+	iter := &iterator{
+		ctx:         ctx,
+		prefix:      []byte(prefix),
+		lower:       lower,
+		upper:       upper,
+		limit:       opts.Limit,
+		reverse:     opts.Reverse,
+		hidden:      db.HidesReserved(prefix),
+		initialized: false,
+		bdb:         bdb,
+		tx:          tx,
+	}
+	iter.open(opts.Reverse)
+	iter.seek(nil, opts.Reverse)
+	return iter
+}
+
+// newClosedIterator returns an iterator that is already closed, and whose Err
+// method returns the given error.
+func newClosedIterator(err error) *iterator {
+	return &iterator{
+		closed: true,
+		err:    err,
+	}
+}
+
+// prefixEnd returns the smallest key that is greater than all keys that begin
+// with the prefix. It returns nil if there is no such key.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
 		}
 	}
+	return nil
 }
 
-// iterator implements the `db.Iterator` interface.
+// iterator implements the `db.Iterator` interface. If hidden is true, then the
+// iterator skips the reserved key-space, and backward is the direction of the
+// badger iterator, which is needed to skip it.
 type iterator struct {
+	ctx         context.Context
 	prefix      []byte
+	lower       []byte
+	upper       []byte
+	limit       int
+	count       int
+	reverse     bool
+	hidden      bool
+	backward    bool
 	initialized bool
+	valid       bool
+	closed      bool
+	err         error
+	bdb         *badgerDB
 	tx          *badger.Txn
 	iter        *badger.Iterator
-	codec       db.Codec
+
+	// discard is true if the transaction is discarded when the iterator is
+	// closed. It is false when the iterator belongs to a `db.Txn` or a
+	// `db.Snapshot`, because the transaction outlives the iterator.
+	discard bool
 }
 
 // Next implements the `db.Iterator` interface.
 func (iter *iterator) Next() bool {
+	if iter.done() {
+		return false
+	}
+	release, ok := iter.use()
+	if !ok {
+		return false
+	}
+	defer release()
 	if !iter.initialized {
 		iter.initialized = true
 	} else {
-		if !iter.iter.Valid() {
+		if !iter.valid {
+			iter.close()
 			return false
 		}
 		iter.iter.Next()
 	}
+	iter.count++
 
-	if valid := iter.iter.Valid(); !valid {
-		iter.iter.Close()
-		iter.tx.Discard()
+	if !iter.update() {
+		iter.close()
 		return false
 	}
 	return true
 }
 
+// Seek implements the `db.Iterator` interface.
+func (iter *iterator) Seek(key string) bool {
+	if iter.done() {
+		return false
+	}
+	release, ok := iter.use()
+	if !ok {
+		return false
+	}
+	defer release()
+	iter.initialized, iter.count = true, 1
+	target := append(append([]byte{}, iter.prefix...), key...)
+	if len(target) == 0 && iter.reverse {
+		// Badger seeks to the end when seeking to an empty key in reverse, but
+		// there are no keys before the empty key.
+		iter.valid = false
+		return false
+	}
+	iter.seek(target, iter.reverse)
+	return iter.update()
+}
+
+// First implements the `db.Iterator` interface.
+func (iter *iterator) First() bool {
+	return iter.seekEnd(false)
+}
+
+// Last implements the `db.Iterator` interface.
+func (iter *iterator) Last() bool {
+	return iter.seekEnd(true)
+}
+
+// seekEnd moves the iterator to the key/value pair with the largest key in the
+// range if last is true, otherwise the smallest key.
+func (iter *iterator) seekEnd(last bool) bool {
+	if iter.done() {
+		return false
+	}
+	release, ok := iter.use()
+	if !ok {
+		return false
+	}
+	defer release()
+	iter.initialized, iter.count = true, 1
+	if last == iter.reverse {
+		iter.seek(nil, last)
+		return iter.update()
+	}
+
+	// A badger iterator can only seek in its own direction, so the key is
+	// found by a badger iterator in the other direction.
+	iter.open(last)
+	iter.seek(nil, last)
+	iter.skip()
+	var key []byte
+	if iter.inRange() {
+		key = iter.iter.Item().KeyCopy(nil)
+	}
+	iter.open(iter.reverse)
+	if key == nil {
+		iter.valid = false
+		return false
+	}
+	iter.iter.Seek(key)
+	return iter.update()
+}
+
+// done returns whether the iterator has been closed. If the context of the
+// iterator is done, then the iterator is closed with the error of the context.
+func (iter *iterator) done() bool {
+	if iter.closed {
+		return true
+	}
+	if err := iter.ctx.Err(); err != nil {
+		iter.Close()
+		iter.err = err
+		return true
+	}
+	return false
+}
+
+// use locks the DB so that it is not closed until the returned function is
+// called. If the DB has already been closed, then the iterator is closed
+// without touching badger, and Err returns `db.ErrClosed`.
+func (iter *iterator) use() (func(), bool) {
+	release, err := iter.bdb.use()
+	if err != nil {
+		iter.closed, iter.valid = true, false
+		if iter.err == nil {
+			iter.err = err
+		}
+		return nil, false
+	}
+	return release, true
+}
+
+// open replaces the badger iterator with a new one that iterates in the given
+// direction. Only one badger iterator can be open at a time in a transaction
+// that can write, so the old one is closed first. Values are not prefetched,
+// because they are read by valueCopy when they are asked for.
+func (iter *iterator) open(reverse bool) {
+	if iter.iter != nil {
+		iter.iter.Close()
+	}
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Reverse = reverse
+	iter.iter = iter.tx.NewIterator(opts)
+	iter.backward = reverse
+}
+
+// skip moves the badger iterator past the reserved key-space, in the direction
+// of the badger iterator, if the iterator skips it and is in it. Seeking in
+// reverse finds the largest key that is less than, or equal to, the start of
+// the reserved key-space, so we skip the start itself.
+func (iter *iterator) skip() {
+	if !iter.hidden || !iter.iter.Valid() || !bytes.HasPrefix(iter.iter.Item().Key(), reserved) {
+		return
+	}
+	if !iter.backward {
+		iter.iter.Seek(reservedEnd)
+		return
+	}
+	iter.iter.Seek(reserved)
+	if iter.iter.Valid() && bytes.Equal(iter.iter.Item().Key(), reserved) {
+		iter.iter.Next()
+	}
+}
+
+// seek moves the badger iterator to the first key/value pair at, or after, the
+// key in the given direction, which must be the direction of the badger
+// iterator. A nil key moves to the bound of the range where iteration starts.
+func (iter *iterator) seek(key []byte, reverse bool) {
+	if !reverse {
+		if key == nil || bytes.Compare(key, iter.lower) < 0 {
+			key = iter.lower
+		}
+		iter.iter.Seek(key)
+		return
+	}
+
+	if key != nil && (iter.upper == nil || bytes.Compare(key, iter.upper) < 0) {
+		iter.iter.Seek(key)
+		return
+	}
+	if iter.upper == nil {
+		iter.iter.Rewind()
+		return
+	}
+
+	// Seeking in reverse finds the largest key that is less than, or equal to,
+	// the upper bound, so we skip the upper bound itself.
+	iter.iter.Seek(iter.upper)
+	if iter.iter.Valid() && bytes.Equal(iter.iter.Item().Key(), iter.upper) {
+		iter.iter.Next()
+	}
+}
+
 // Key implements the `db.Iterator` interface.
 func (iter *iterator) Key() (string, error) {
-	if !iter.initialized || !iter.iter.Valid() {
+	if !iter.valid {
 		return "", db.ErrIndexOutOfRange
 	}
+	release, err := iter.bdb.use()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
 	key := iter.iter.Item().Key()
 	return string(bytes.TrimPrefix(key, iter.prefix)), nil
 }
 
 // Value implements the `db.Iterator` interface.
 func (iter *iterator) Value(value interface{}) error {
-	if !iter.initialized || !iter.iter.Valid() {
+	if !iter.valid {
 		return db.ErrIndexOutOfRange
 	}
-	data, err := iter.iter.Item().ValueCopy(nil)
+	release, err := iter.bdb.use()
 	if err != nil {
 		return err
 	}
-	return iter.codec.Decode(data, value)
+	defer release()
+
+	data, err := iter.valueCopy()
+	if err != nil {
+		return err
+	}
+	return iter.bdb.codec.Decode(data, value)
+}
+
+// ValueBytes implements the `db.Iterator` interface.
+func (iter *iterator) ValueBytes() ([]byte, error) {
+	if !iter.valid {
+		return nil, db.ErrIndexOutOfRange
+	}
+	release, err := iter.bdb.use()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return iter.valueCopy()
+}
+
+// valueCopy returns a copy of the value of the current key/value pair. Values
+// are only read when they are asked for, so that iterating over keys does not
+// read the value log. If the value could not be read, then the error is also
+// recorded, so that it is returned by Err.
+func (iter *iterator) valueCopy() ([]byte, error) {
+	data, err := iter.iter.Item().ValueCopy(nil)
+	if err != nil && iter.err == nil {
+		iter.err = err
+	}
+	return data, err
+}
+
+// Err implements the `db.Iterator` interface.
+func (iter *iterator) Err() error {
+	return iter.err
 }
 
-// Close implements the `db.Iterator` interface.
+// Close implements the `db.Iterator` interface. If the DB has already been
+// closed, then badger has freed the iterator, so it is not closed again.
 func (iter *iterator) Close() {
-	iter.iter.Close()
-	iter.tx.Discard()
+	if iter.closed {
+		return
+	}
+	release, err := iter.bdb.use()
+	if err != nil {
+		iter.closed, iter.valid = true, false
+		return
+	}
+	defer release()
+	iter.close()
+}
+
+// close closes the badger iterator, and discards the transaction if needed.
+// The DB must be in use by the caller.
+func (iter *iterator) close() {
+	iter.closed = true
+	iter.valid = false
+	if iter.iter != nil {
+		iter.iter.Close()
+	}
+	if iter.discard {
+		iter.tx.Discard()
+	}
+}
+
+// update skips the reserved key-space if needed, then sets whether the iterator
+// is at a key/value pair that is in the range of the iterator, and returns it.
+func (iter *iterator) update() bool {
+	iter.skip()
+	iter.valid = iter.inRange()
+	return iter.valid
+}
+
+// inRange returns whether the iterator is at a key/value pair that is in the
+// range of the iterator.
+func (iter *iterator) inRange() bool {
+	if !iter.iter.Valid() {
+		return false
+	}
+	if iter.limit > 0 && iter.count > iter.limit {
+		return false
+	}
+	key := iter.iter.Item().Key()
+	if bytes.Compare(key, iter.lower) < 0 {
+		return false
+	}
+	return iter.upper == nil || bytes.Compare(key, iter.upper) < 0
 }
 
 // convertErr will convert badgerDB-specific error to kv error.
@@ -191,6 +962,8 @@ func convertErr(err error) error {
 		return db.ErrEmptyKey
 	case badger.ErrKeyNotFound:
 		return db.ErrKeyNotFound
+	case badger.ErrConflict:
+		return db.ErrConflict
 	default:
 		return err
 	}
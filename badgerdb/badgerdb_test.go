@@ -3,8 +3,11 @@ package badgerdb_test
 import (
 	"fmt"
 	"reflect"
+	"sync"
 	"testing/quick"
+	"time"
 
+	"github.com/dgraph-io/badger"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/renproject/kv/badgerdb"
@@ -152,6 +155,139 @@ var _ = Describe("badger DB implementation of the db", func() {
 			})
 		})
 
+		Context("when committing a txn that read a key which has since been modified", func() {
+			It("should return ErrConflict and not write anything", func() {
+				badgerDB := New(".badgerdb", codec)
+				defer badgerDB.Close()
+
+				test := func(key string, value, other testutil.TestStruct) bool {
+					if key == "" {
+						return true
+					}
+
+					txn, err := badgerDB.NewTxn()
+					Expect(err).NotTo(HaveOccurred())
+					defer txn.Discard()
+
+					stored := testutil.TestStruct{D: []byte{}}
+					Expect(txn.Get(key, &stored)).Should(Equal(db.ErrKeyNotFound))
+					Expect(txn.Insert(key, value)).Should(Succeed())
+
+					// Modify the key outside of the txn after it has been read.
+					Expect(badgerDB.Insert(key, other)).Should(Succeed())
+					Expect(txn.Commit()).Should(Equal(db.ErrConflict))
+
+					stored = testutil.TestStruct{D: []byte{}}
+					Expect(badgerDB.Get(key, &stored)).Should(Succeed())
+					Expect(reflect.DeepEqual(stored, other)).Should(BeTrue())
+					Expect(badgerDB.Delete(key)).Should(Succeed())
+					return true
+				}
+
+				Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when committing a batch of a counted table that does not fit into a txn", func() {
+			It("should return ErrTxnTooBig and not write anything", func() {
+				badgerDB := New(".badgerdb", codec)
+				defer badgerDB.Close()
+
+				table, err := db.NewCountedTable(badgerDB, "counted")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(table.Insert("key", []byte{})).Should(Succeed())
+
+				// Every write also writes the count, so the batch has more
+				// writes than badger allows in a txn.
+				value := []byte{}
+				batch := table.NewBatch()
+				for i := 0; i < 60000; i++ {
+					Expect(batch.Insert(fmt.Sprintf("%05d", i), value)).Should(Succeed())
+				}
+				Expect(batch.Commit()).Should(Equal(badger.ErrTxnTooBig))
+
+				size, err := table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+				Expect(table.Has("00000")).Should(BeFalse())
+
+				// The same writes fit into smaller batches.
+				for start := 0; start < 60000; start += 20000 {
+					batch := table.NewBatch()
+					for i := start; i < start+20000; i++ {
+						Expect(batch.Insert(fmt.Sprintf("%05d", i), value)).Should(Succeed())
+					}
+					Expect(batch.Commit()).Should(Succeed())
+				}
+				size, err = table.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(60001))
+			})
+		})
+
+		Context("when closing the db while it is being used", func() {
+			It("should return ErrClosed instead of crashing", func() {
+				badgerDB := New(".badgerdb", codec)
+				for i := 0; i < 100; i++ {
+					Expect(badgerDB.Insert(fmt.Sprintf("key%v", i), testutil.RandomTestStruct())).Should(Succeed())
+				}
+
+				// Iterators, txns and snapshots that are open when the db is
+				// closed can still be closed afterwards.
+				iter := badgerDB.Iterator("")
+				Expect(iter.Next()).Should(BeTrue())
+				txn, err := badgerDB.NewTxn()
+				Expect(err).NotTo(HaveOccurred())
+				snapshot, err := badgerDB.Snapshot()
+				Expect(err).NotTo(HaveOccurred())
+
+				var wg sync.WaitGroup
+				for i := 0; i < 4; i++ {
+					value := testutil.RandomTestStruct()
+					wg.Add(1)
+					go func(i int) {
+						defer GinkgoRecover()
+						defer wg.Done()
+
+						for {
+							if err := badgerDB.Insert(fmt.Sprintf("key%v", i), value); err != nil {
+								Expect(err).Should(Equal(db.ErrClosed))
+								return
+							}
+							iter := badgerDB.Iterator("")
+							for iter.Next() {
+								_, err := iter.Key()
+								Expect(err).NotTo(HaveOccurred())
+							}
+							iter.Close()
+							if err := iter.Err(); err != nil {
+								Expect(err).Should(Equal(db.ErrClosed))
+								return
+							}
+						}
+					}(i)
+				}
+				time.Sleep(10 * time.Millisecond)
+				Expect(badgerDB.Close()).Should(Succeed())
+				wg.Wait()
+
+				Expect(iter.Next()).Should(BeFalse())
+				Expect(iter.Err()).Should(Equal(db.ErrClosed))
+				iter.Close()
+				Expect(txn.Insert("key", testutil.RandomTestStruct())).Should(Equal(db.ErrClosed))
+				txn.Discard()
+				_, err = snapshot.Size("")
+				Expect(err).Should(Equal(db.ErrClosed))
+				snapshot.Release()
+
+				Expect(badgerDB.Get("key0", &testutil.TestStruct{})).Should(Equal(db.ErrClosed))
+				_, err = badgerDB.NewTxn()
+				Expect(err).Should(Equal(db.ErrClosed))
+				Expect(badgerDB.Iterator("").Err()).Should(Equal(db.ErrClosed))
+				Expect(badgerDB.Close()).Should(Succeed())
+			})
+		})
+
 		Context("when trying to create more than one db using the same path", func() {
 			It("should panic", func() {
 				badgerDB := New(".badgerdb", codec)
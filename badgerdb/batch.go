@@ -0,0 +1,96 @@
+package badgerdb
+
+import (
+	"strings"
+
+	"github.com/dgraph-io/badger"
+	"github.com/renproject/kv/db"
+)
+
+// write is a single insert, or delete, that is buffered in a batch.
+type write struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batch is a badgerDB implementation of the `db.Batch`. Writes are buffered
+// and applied in a single update transaction on commit.
+//
+// NOTE: We do not use the `badger.WriteBatch`, because it splits writes across
+// multiple transactions when they do not fit into one, and so does not
+// guarantee atomicity. If a batch does not fit into a single transaction,
+// committing it will fail with `badger.ErrTxnTooBig`. Writes to the reserved
+// key-space are counted separately, so that they are not included in the
+// length of the batch.
+type batch struct {
+	bdb      *badgerDB
+	writes   []write
+	reserved int
+}
+
+// Insert implements the `db.Batch` interface.
+func (batch *batch) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := batch.bdb.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	batch.writes = append(batch.writes, write{key: []byte(key), value: data})
+	batch.count(key)
+	return nil
+}
+
+// Delete implements the `db.Batch` interface.
+func (batch *batch) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	batch.writes = append(batch.writes, write{key: []byte(key), delete: true})
+	batch.count(key)
+	return nil
+}
+
+// Len implements the `db.Batch` interface.
+func (batch *batch) Len() int {
+	return len(batch.writes) - batch.reserved
+}
+
+// count records a write to the key if it is in the reserved key-space.
+func (batch *batch) count(key string) {
+	if strings.HasPrefix(key, db.ReservedPrefix) {
+		batch.reserved++
+	}
+}
+
+// Commit implements the `db.Batch` interface.
+func (batch *batch) Commit() error {
+	release, err := batch.bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = batch.bdb.db.Update(func(txn *badger.Txn) error {
+		for _, w := range batch.writes {
+			if w.delete {
+				if err := txn.Delete(w.key); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := txn.Set(w.key, w.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return convertErr(err)
+	}
+	batch.writes = batch.writes[:0]
+	batch.reserved = 0
+	return nil
+}
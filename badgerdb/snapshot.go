@@ -0,0 +1,76 @@
+package badgerdb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dgraph-io/badger"
+	"github.com/renproject/kv/db"
+)
+
+// snapshot is a badgerDB implementation of the `db.Snapshot`. It is backed by a
+// native read-only `badger.Txn`, which reads the DB at the time that it was
+// created.
+type snapshot struct {
+	bdb *badgerDB
+	tx  *badger.Txn
+
+	releaseOnce sync.Once
+}
+
+// Get implements the `db.Snapshot` interface.
+func (snapshot *snapshot) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	release, err := snapshot.bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	item, err := snapshot.tx.Get([]byte(key))
+	if err != nil {
+		return convertErr(err)
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	return snapshot.bdb.codec.Decode(data, value)
+}
+
+// Size implements the `db.Snapshot` interface.
+func (snapshot *snapshot) Size(prefix string) (int, error) {
+	release, err := snapshot.bdb.use()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	return size(context.Background(), snapshot.tx, prefix)
+}
+
+// Iterator implements the `db.Snapshot` interface.
+func (snapshot *snapshot) Iterator(prefix string) db.Iterator {
+	release, err := snapshot.bdb.use()
+	if err != nil {
+		return newClosedIterator(err)
+	}
+	defer release()
+
+	return newIterator(context.Background(), snapshot.bdb, snapshot.tx, prefix, db.IteratorOptions{})
+}
+
+// Release implements the `db.Snapshot` interface. If the DB has already been
+// closed, then there is nothing left to release.
+func (snapshot *snapshot) Release() {
+	snapshot.releaseOnce.Do(func() {
+		release, err := snapshot.bdb.use()
+		if err != nil {
+			return
+		}
+		defer release()
+		snapshot.tx.Discard()
+	})
+}
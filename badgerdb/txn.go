@@ -0,0 +1,186 @@
+package badgerdb
+
+import (
+	"context"
+
+	"github.com/dgraph-io/badger"
+	"github.com/renproject/kv/db"
+)
+
+// txn is a badgerDB implementation of the `db.Txn`. It is backed by a native
+// read/write `badger.Txn`, which detects conflicts optimistically when it is
+// committed.
+type txn struct {
+	bdb  *badgerDB
+	tx   *badger.Txn
+	done bool
+}
+
+// Get implements the `db.Txn` interface.
+func (txn *txn) Get(key string, value interface{}) error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	release, err := txn.bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	item, err := txn.tx.Get([]byte(key))
+	if err != nil {
+		return convertErr(err)
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	return txn.bdb.codec.Decode(data, value)
+}
+
+// Insert implements the `db.Txn` interface.
+func (txn *txn) Insert(key string, value interface{}) error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	data, err := txn.bdb.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	release, err := txn.bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return convertErr(txn.tx.Set([]byte(key), data))
+}
+
+// Has implements the `db.Txn` interface.
+func (txn *txn) Has(key string) (bool, error) {
+	if txn.done {
+		return false, db.ErrTxnDone
+	}
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	release, err := txn.bdb.use()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	_, err = txn.tx.Get([]byte(key))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, convertErr(err)
+}
+
+// InsertRaw implements the `db.Txn` interface. The data is copied, because
+// badger holds on to it until the txn is committed.
+func (txn *txn) InsertRaw(key string, data []byte) error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	release, err := txn.bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return convertErr(txn.tx.Set([]byte(key), append([]byte{}, data...)))
+}
+
+// GetRaw implements the `db.Txn` interface.
+func (txn *txn) GetRaw(key string) ([]byte, error) {
+	if txn.done {
+		return nil, db.ErrTxnDone
+	}
+	if key == "" {
+		return nil, db.ErrEmptyKey
+	}
+	release, err := txn.bdb.use()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	item, err := txn.tx.Get([]byte(key))
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	return item.ValueCopy(nil)
+}
+
+// Delete implements the `db.Txn` interface.
+func (txn *txn) Delete(key string) error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	release, err := txn.bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return convertErr(txn.tx.Delete([]byte(key)))
+}
+
+// Iterator implements the `db.Txn` interface.
+func (txn *txn) Iterator(prefix string) db.Iterator {
+	if txn.done {
+		return newClosedIterator(db.ErrTxnDone)
+	}
+	release, err := txn.bdb.use()
+	if err != nil {
+		return newClosedIterator(err)
+	}
+	defer release()
+
+	return newIterator(context.Background(), txn.bdb, txn.tx, prefix, db.IteratorOptions{})
+}
+
+// Commit implements the `db.Txn` interface.
+func (txn *txn) Commit() error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	txn.done = true
+	release, err := txn.bdb.use()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return convertErr(txn.tx.Commit())
+}
+
+// Discard implements the `db.Txn` interface. If the DB has already been
+// closed, then there is nothing left to discard.
+func (txn *txn) Discard() {
+	if txn.done {
+		return
+	}
+	txn.done = true
+	release, err := txn.bdb.use()
+	if err != nil {
+		return
+	}
+	defer release()
+
+	txn.tx.Discard()
+}
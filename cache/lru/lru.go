@@ -1,6 +1,7 @@
 package lru
 
 import (
+	"context"
 	"reflect"
 	"sync"
 
@@ -12,28 +13,175 @@ type lruTable struct {
 	mu    *sync.Mutex
 	lru   *lru.Cache
 	table db.Table
+
+	// subTables are the sub-tables that have been created, by name, so that
+	// each of them has a single cache. They are guarded by mu.
+	subTables map[string]*lruTable
 }
 
 // NewLruTable return a lru cached table of the given table.
 func NewLruTable(table db.Table, maxEntries int) db.Table {
+	return newLruTable(table, maxEntries)
+}
+
+func newLruTable(table db.Table, maxEntries int) *lruTable {
 	return &lruTable{
-		mu:    new(sync.Mutex),
-		lru:   lru.New(maxEntries),
-		table: table,
+		mu:        new(sync.Mutex),
+		lru:       lru.New(maxEntries),
+		table:     table,
+		subTables: map[string]*lruTable{},
 	}
 }
 
 // Insert implements the `table` interface.
 func (table *lruTable) Insert(key string, value interface{}) error {
+	return table.InsertContext(context.Background(), key, value)
+}
+
+// Get implements the `table` interface.
+func (table *lruTable) Get(key string, value interface{}) error {
+	return table.GetContext(context.Background(), key, value)
+}
+
+// Delete implements the `table` interface.
+func (table *lruTable) Delete(key string) error {
+	return table.DeleteContext(context.Background(), key)
+}
+
+// Has implements the `table` interface.
+func (table *lruTable) Has(key string) (bool, error) {
+	var ok bool
 	table.mutexLru(func(cache *lru.Cache) {
-		cache.Add(key, value)
+		_, ok = cache.Get(key)
 	})
 
-	return table.table.Insert(key, value)
+	if ok {
+		return true, nil
+	}
+	return table.table.Has(key)
 }
 
-// Get implements the `table` interface.
-func (table *lruTable) Get(key string, value interface{}) error {
+// InsertIfAbsent implements the `table` interface. Conditional writes are not
+// cached, so the key is removed from the cache once the write is done.
+func (table *lruTable) InsertIfAbsent(key string, value interface{}) (bool, error) {
+	defer table.remove(key)
+	return table.table.InsertIfAbsent(key, value)
+}
+
+// DeleteIfEquals implements the `table` interface.
+func (table *lruTable) DeleteIfEquals(key string, value interface{}) (bool, error) {
+	defer table.remove(key)
+	return table.table.DeleteIfEquals(key, value)
+}
+
+// CompareAndSwap implements the `table` interface.
+func (table *lruTable) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	defer table.remove(key)
+	return table.table.CompareAndSwap(key, old, new)
+}
+
+// Update implements the `table` interface. The updated value is not cached,
+// so the key is removed from the cache once the update is done.
+func (table *lruTable) Update(key string, ptr interface{}, fn func(exists bool) error) error {
+	defer table.remove(key)
+	return table.table.Update(key, ptr, fn)
+}
+
+// Merge implements the `table` interface. Merged values are not cached, so the
+// key is removed from the cache once the merge is done.
+func (table *lruTable) Merge(key, name string, value interface{}) error {
+	defer table.remove(key)
+	return table.table.Merge(key, name, value)
+}
+
+// Increment implements the `table` interface.
+func (table *lruTable) Increment(key string, delta int64) error {
+	return table.Merge(key, db.MergeAdd, delta)
+}
+
+// Clear implements the `table` interface. The whole cache is cleared, because
+// all of the cached keys belong to the table.
+func (table *lruTable) Clear() error {
+	defer table.mutexLru(func(cache *lru.Cache) {
+		cache.Clear()
+	})
+	return table.table.Clear()
+}
+
+// Drop implements the `table` interface. Dropping the table also drops its
+// sub-tables, so the caches of its sub-tables are cleared too.
+func (table *lruTable) Drop() error {
+	defer table.clearAll()
+	return table.table.Drop()
+}
+
+// SubTable implements the `table` interface. The sub-table has its own cache,
+// with the same maximum number of entries. The sub-table is only created the
+// first time it is asked for, so that every write to it evicts keys from the
+// same cache.
+func (table *lruTable) SubTable(name string) db.Table {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	if sub, ok := table.subTables[name]; ok {
+		return sub
+	}
+	sub := newLruTable(table.table.SubTable(name), table.lru.MaxEntries)
+	table.subTables[name] = sub
+	return sub
+}
+
+// SubTableNames implements the `table` interface.
+func (table *lruTable) SubTableNames() ([]string, error) {
+	return table.table.SubTableNames()
+}
+
+// Size implements the `table` interface.
+func (table *lruTable) Size() (int, error) {
+	// NOTE: It does not make sense to return the cache's len because the cache
+	// might only have a subset of the actual data.
+	return table.table.Size()
+}
+
+// Stats implements the `table` interface.
+func (table *lruTable) Stats() (db.Stats, error) {
+	return table.table.Stats()
+}
+
+// Iterator implements the `table` interface.
+func (table *lruTable) Iterator() db.Iterator {
+	return table.table.Iterator()
+}
+
+// RangeIterator implements the `table` interface.
+func (table *lruTable) RangeIterator(start, end string, limit int) db.Iterator {
+	return table.table.RangeIterator(start, end, limit)
+}
+
+// IteratorWithOptions implements the `table` interface.
+func (table *lruTable) IteratorWithOptions(opts db.IteratorOptions) db.Iterator {
+	return table.table.IteratorWithOptions(opts)
+}
+
+// InsertContext implements the `table` interface. The value is only cached
+// once it has been written to the underlying table.
+func (table *lruTable) InsertContext(ctx context.Context, key string, value interface{}) error {
+	if err := table.table.InsertContext(ctx, key, value); err != nil {
+		return err
+	}
+
+	table.mutexLru(func(cache *lru.Cache) {
+		cache.Add(key, value)
+	})
+	return nil
+}
+
+// GetContext implements the `table` interface.
+func (table *lruTable) GetContext(ctx context.Context, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	var val interface{}
 	var ok bool
 	table.mutexLru(func(cache *lru.Cache) {
@@ -48,28 +196,112 @@ func (table *lruTable) Get(key string, value interface{}) error {
 			return nil
 		}
 	}
-	return table.table.Get(key, value)
+	return table.table.GetContext(ctx, key, value)
 }
 
-// Delete implements the `table` interface.
-func (table *lruTable) Delete(key string) error {
+// DeleteContext implements the `table` interface.
+func (table *lruTable) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	table.mutexLru(func(cache *lru.Cache) {
 		cache.Remove(key)
 	})
 
-	return table.table.Delete(key)
+	return table.table.DeleteContext(ctx, key)
 }
 
-// Size implements the `table` interface.
-func (table *lruTable) Size() (int, error) {
-	// NOTE: It does not make sense to return the cache's len because the cache
-	// might only have a subset of the actual data.
-	return table.table.Size()
+// SizeContext implements the `table` interface.
+func (table *lruTable) SizeContext(ctx context.Context) (int, error) {
+	return table.table.SizeContext(ctx)
 }
 
-// Iterator implements the `table` interface.
-func (table *lruTable) Iterator() db.Iterator {
-	return table.table.Iterator()
+// IteratorContext implements the `table` interface.
+func (table *lruTable) IteratorContext(ctx context.Context, opts db.IteratorOptions) db.Iterator {
+	return table.table.IteratorContext(ctx, opts)
+}
+
+// InsertRaw implements the `table` interface. The cache holds decoded values,
+// so the key is removed from the cache instead of caching the raw value.
+func (table *lruTable) InsertRaw(key string, data []byte) error {
+	table.mutexLru(func(cache *lru.Cache) {
+		cache.Remove(key)
+	})
+
+	return table.table.InsertRaw(key, data)
+}
+
+// GetRaw implements the `table` interface. It always reads from the underlying
+// table, because the cache holds decoded values.
+func (table *lruTable) GetRaw(key string) ([]byte, error) {
+	return table.table.GetRaw(key)
+}
+
+// Scan implements the `table` interface.
+func (table *lruTable) Scan(cursor string, limit int) ([]db.Entry, string, error) {
+	return db.ScanTable(table, cursor, limit)
+}
+
+// NewBatch implements the `table` interface.
+func (table *lruTable) NewBatch() db.Batch {
+	return &lruBatch{
+		batch: table.table.NewBatch(),
+		table: table,
+	}
+}
+
+// Batch implements the `table` interface.
+func (table *lruTable) Batch(batch db.Batch) db.Batch {
+	return &lruBatch{
+		batch: table.table.Batch(batch),
+		table: table,
+	}
+}
+
+// Txn implements the `table` interface. Reads in the txn always go to the
+// underlying table, so that they are tracked by the txn.
+func (table *lruTable) Txn(txn db.Txn) db.Txn {
+	return &lruTxn{
+		txn:   table.table.Txn(txn),
+		table: table,
+	}
+}
+
+// Snapshot implements the `table` interface. Reads from the snapshot never use
+// the cache, because the cache might have values written after the snapshot.
+func (table *lruTable) Snapshot(snapshot db.Snapshot) db.Snapshot {
+	return table.table.Snapshot(snapshot)
+}
+
+// remove evicts the key from the cache.
+func (table *lruTable) remove(key string) {
+	table.mutexLru(func(cache *lru.Cache) {
+		cache.Remove(key)
+	})
+}
+
+// removeAll evicts the keys from the cache.
+func (table *lruTable) removeAll(keys []string) {
+	table.mutexLru(func(cache *lru.Cache) {
+		for _, key := range keys {
+			cache.Remove(key)
+		}
+	})
+}
+
+// clearAll clears the cache of the table, and of all of its sub-tables.
+func (table *lruTable) clearAll() {
+	var subTables []*lruTable
+	table.mutexLru(func(cache *lru.Cache) {
+		cache.Clear()
+		for _, sub := range table.subTables {
+			subTables = append(subTables, sub)
+		}
+	})
+	for _, sub := range subTables {
+		sub.clearAll()
+	}
 }
 
 // mutexLru takes a operation of the cache and lock/unlock the mutex before/after
@@ -80,3 +312,112 @@ func (table *lruTable) mutexLru(operation func(*lru.Cache)) {
 
 	operation(table.lru)
 }
+
+// lruBatch is a view of a batch which evicts keys from the cache when they are
+// written into the batch, and again once the batch is committed. Values are
+// never cached on a miss, so evicting the key is enough to make sure that reads
+// after the commit go to the table, even if the key was cached while the write
+// was buffered.
+type lruBatch struct {
+	batch db.Batch
+	table *lruTable
+	keys  []string
+}
+
+// Insert implements the `db.Batch` interface.
+func (batch *lruBatch) Insert(key string, value interface{}) error {
+	batch.table.remove(key)
+	batch.keys = append(batch.keys, key)
+
+	return batch.batch.Insert(key, value)
+}
+
+// Delete implements the `db.Batch` interface.
+func (batch *lruBatch) Delete(key string) error {
+	batch.table.remove(key)
+	batch.keys = append(batch.keys, key)
+
+	return batch.batch.Delete(key)
+}
+
+// Len implements the `db.Batch` interface.
+func (batch *lruBatch) Len() int {
+	return batch.batch.Len()
+}
+
+// Commit implements the `db.Batch` interface.
+func (batch *lruBatch) Commit() error {
+	if err := batch.batch.Commit(); err != nil {
+		return err
+	}
+	batch.table.removeAll(batch.keys)
+	batch.keys = nil
+	return nil
+}
+
+// lruTxn is a view of a txn which evicts keys from the cache when they are
+// written in the txn, and again once the txn is committed.
+type lruTxn struct {
+	txn   db.Txn
+	table *lruTable
+	keys  []string
+}
+
+// Get implements the `db.Txn` interface.
+func (txn *lruTxn) Get(key string, value interface{}) error {
+	return txn.txn.Get(key, value)
+}
+
+// Insert implements the `db.Txn` interface.
+func (txn *lruTxn) Insert(key string, value interface{}) error {
+	txn.table.remove(key)
+	txn.keys = append(txn.keys, key)
+
+	return txn.txn.Insert(key, value)
+}
+
+// Delete implements the `db.Txn` interface.
+func (txn *lruTxn) Delete(key string) error {
+	txn.table.remove(key)
+	txn.keys = append(txn.keys, key)
+
+	return txn.txn.Delete(key)
+}
+
+// Has implements the `db.Txn` interface.
+func (txn *lruTxn) Has(key string) (bool, error) {
+	return txn.txn.Has(key)
+}
+
+// InsertRaw implements the `db.Txn` interface.
+func (txn *lruTxn) InsertRaw(key string, data []byte) error {
+	txn.table.remove(key)
+	txn.keys = append(txn.keys, key)
+
+	return txn.txn.InsertRaw(key, data)
+}
+
+// GetRaw implements the `db.Txn` interface.
+func (txn *lruTxn) GetRaw(key string) ([]byte, error) {
+	return txn.txn.GetRaw(key)
+}
+
+// Iterator implements the `db.Txn` interface.
+func (txn *lruTxn) Iterator(prefix string) db.Iterator {
+	return txn.txn.Iterator(prefix)
+}
+
+// Commit implements the `db.Txn` interface.
+func (txn *lruTxn) Commit() error {
+	if err := txn.txn.Commit(); err != nil {
+		return err
+	}
+	txn.table.removeAll(txn.keys)
+	txn.keys = nil
+	return nil
+}
+
+// Discard implements the `db.Txn` interface.
+func (txn *lruTxn) Discard() {
+	txn.txn.Discard()
+}
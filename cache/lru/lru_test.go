@@ -10,6 +10,7 @@ import (
 	. "github.com/renproject/kv/cache/lru"
 
 	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
 	"github.com/renproject/kv/testutil"
 )
 
@@ -39,14 +40,24 @@ var _ = Describe("lru cache table wrapper", func() {
 						err := table.Get(key, &val)
 						Expect(err).Should(Equal(db.ErrKeyNotFound))
 
+						ok, err := table.Has(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
+
 						// Should be able to read the value after inserting.
 						Expect(table.Insert(key, value)).NotTo(HaveOccurred())
+						ok, err = table.Has(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeTrue())
 						err = table.Get(key, &val)
 						Expect(err).NotTo(HaveOccurred())
 						Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
 
 						// Expect no value exists after deleting the value.
 						Expect(table.Delete(key)).NotTo(HaveOccurred())
+						ok, err = table.Has(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
 						err = table.Get(key, &val)
 						Expect(err).Should(Equal(db.ErrKeyNotFound))
 
@@ -98,7 +109,135 @@ var _ = Describe("lru cache table wrapper", func() {
 
 					Expect(quick.Check(iteration, nil)).NotTo(HaveOccurred())
 				})
+
+				It("should not return cached values after updating", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					table := NewLruTable(db.NewTable(database, "table"), 10)
+					Expect(table.Insert("counter", uint64(1))).Should(Succeed())
+					counter := uint64(0)
+					Expect(table.Get("counter", &counter)).Should(Succeed())
+					Expect(table.Update("counter", &counter, func(exists bool) error {
+						Expect(exists).Should(BeTrue())
+						counter++
+						return nil
+					})).Should(Succeed())
+
+					stored := uint64(0)
+					Expect(table.Get("counter", &stored)).Should(Succeed())
+					Expect(stored).Should(Equal(uint64(2)))
+				})
+
+				It("should not return cached values after incrementing", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					table := NewLruTable(db.NewTable(database, "table"), 10)
+					Expect(table.Insert("counter", int64(1))).Should(Succeed())
+					counter := int64(0)
+					Expect(table.Get("counter", &counter)).Should(Succeed())
+					Expect(table.Increment("counter", 2)).Should(Succeed())
+					Expect(table.Get("counter", &counter)).Should(Succeed())
+					Expect(counter).Should(Equal(int64(3)))
+				})
+
+				It("should not return cached values after inserting raw bytes", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					test := func(name, key string, value, other testutil.TestStruct) bool {
+						if key == "" {
+							return true
+						}
+						table := NewLruTable(db.NewTable(database, name), 10)
+						Expect(table.Insert(key, value)).Should(Succeed())
+
+						data, err := codec.Encode(other)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(table.InsertRaw(key, data)).Should(Succeed())
+
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(table.Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, other)).Should(BeTrue())
+						Expect(table.Delete(key)).Should(Succeed())
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should not return values cached before a batch is committed", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					table := NewLruTable(db.NewTable(database, "table"), 10)
+					batch := table.NewBatch()
+					Expect(batch.Insert("key", uint64(1))).Should(Succeed())
+					Expect(table.Insert("key", uint64(2))).Should(Succeed())
+					Expect(batch.Commit()).Should(Succeed())
+
+					stored := uint64(0)
+					Expect(table.Get("key", &stored)).Should(Succeed())
+					Expect(stored).Should(Equal(uint64(1)))
+				})
+			})
+
+			Context("when using sub-tables", func() {
+				It("should share the cache of sub-tables with the same name", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					table := NewLruTable(db.NewTable(database, "table"), 10)
+					sub := table.SubTable("sub")
+					Expect(table.SubTable("sub")).Should(BeIdenticalTo(sub))
+
+					Expect(sub.Insert("key", uint64(1))).Should(Succeed())
+					Expect(table.SubTable("sub").Insert("key", uint64(2))).Should(Succeed())
+
+					stored := uint64(0)
+					Expect(sub.Get("key", &stored)).Should(Succeed())
+					Expect(stored).Should(Equal(uint64(2)))
+				})
+
+				It("should clear the caches of sub-tables when the table is dropped", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					table := NewLruTable(db.NewTable(database, "table"), 10)
+					sub := table.SubTable("sub").SubTable("sub")
+					Expect(sub.Insert("key", uint64(1))).Should(Succeed())
+					Expect(table.Drop()).Should(Succeed())
+
+					stored := uint64(0)
+					Expect(sub.Get("key", &stored)).Should(Equal(db.ErrKeyNotFound))
+				})
 			})
 		}
+
+		// Txns of the leveldb hold the write lock of the DB, so the key cannot
+		// be cached by another write while the txn is open.
+		codec := testutil.Codecs[i]
+		Context("when committing a txn", func() {
+			It("should not return values cached before the txn is committed", func() {
+				database := memdb.New(codec)
+				defer database.Close()
+
+				// The table is registered before the txn is opened, so that
+				// registering it does not conflict with the txn.
+				table := NewLruTable(db.NewTable(database, "table"), 10)
+				Expect(table.Insert("other", uint64(0))).Should(Succeed())
+				txn, err := database.NewTxn()
+				Expect(err).NotTo(HaveOccurred())
+				view := table.Txn(txn)
+				Expect(view.Insert("key", uint64(1))).Should(Succeed())
+				Expect(table.Insert("key", uint64(2))).Should(Succeed())
+				Expect(view.Commit()).Should(Succeed())
+
+				stored := uint64(0)
+				Expect(table.Get("key", &stored)).Should(Succeed())
+				Expect(stored).Should(Equal(uint64(1)))
+			})
+		})
 	}
 })
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/renproject/kv/db"
@@ -17,60 +18,210 @@ var (
 )
 
 type table struct {
+	ctx           context.Context
 	db            db.DB
+	name          string
 	nameHash      string
+	parent        *table
 	pruneInterval time.Duration
+
+	// subTables are the sub-tables that have been created, by name, so that
+	// each of them is only pruned once.
+	subTablesMu *sync.Mutex
+	subTables   map[string]*table
+}
+
+// writer is implemented by the db.DB, the db.Batch and the db.Txn.
+type writer interface {
+	Insert(key string, value interface{}) error
+	Delete(key string) error
 }
 
 // Insert the key into the table and also record timestamp associated the key
 // in a corresponding table in the db.
 func (ttlTable *table) Insert(key string, value interface{}) error {
+	return ttlTable.InsertContext(context.Background(), key, value)
+}
+
+// insert writes the key into the table, and records the timestamp associated
+// with the key, using the given writer.
+func (ttlTable *table) insert(w writer, key string, value interface{}) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
-	if err := ttlTable.db.Insert(ttlTable.keyWithPrefix(key), value); err != nil {
+	if err := w.Insert(ttlTable.keyWithPrefix(key), value); err != nil {
 		return fmt.Errorf("error inserting ttl data: %v", err)
 	}
+	return ttlTable.touch(w, key)
+}
 
+// touch records the timestamp associated with the key, using the given writer.
+// Nothing is written to the db directly, because the writer can be a txn that
+// holds the locks of the db.
+func (ttlTable *table) touch(w writer, key string) error {
 	// Delete it from any previous slots in case it exists to prevent the data
 	// from being pruned in advance.
 	slot := ttlTable.slotNo(time.Now())
-	pointer, err := ttlTable.prunePointer()
+	pointer, err := ttlTable.initPrunePointer(w)
 	if err != nil {
 		return fmt.Errorf("error fetching prune pointer: %v", err)
 	}
 	for i := pointer; i < slot; i++ {
-		if err := ttlTable.db.Delete(ttlTable.keyWithSlotPrefix(key, i)); err != nil {
+		if err := w.Delete(ttlTable.keyWithSlotPrefix(key, i)); err != nil {
 			return fmt.Errorf("error removing key=%v from slot=%d (current slot=%d): %v", key, i, slot, err)
 		}
 	}
 
 	// Insert the current timestamp for future pruning.
-	return ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(key, slot), []byte{})
+	return w.Insert(ttlTable.keyWithSlotPrefix(key, slot), []byte{})
 }
 
 // Get implements the db.Table interface.
 func (ttlTable *table) Get(key string, value interface{}) error {
-	if key == "" {
-		return db.ErrEmptyKey
-	}
-
-	return ttlTable.db.Get(ttlTable.keyWithPrefix(key), value)
+	return ttlTable.GetContext(context.Background(), key, value)
 }
 
 // Delete only deletes the data, but not the timestamp which will be handled
 // by the prune function.
 func (ttlTable *table) Delete(key string) error {
+	return ttlTable.DeleteContext(context.Background(), key)
+}
+
+// Has implements the db.Table interface.
+func (ttlTable *table) Has(key string) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	return ttlTable.db.Has(ttlTable.keyWithPrefix(key))
+}
+
+// InsertIfAbsent implements the db.Table interface. The timestamp associated
+// with the key is only recorded if the key-value is written.
+func (ttlTable *table) InsertIfAbsent(key string, value interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	ok, err := ttlTable.db.InsertIfAbsent(ttlTable.keyWithPrefix(key), value)
+	if !ok || err != nil {
+		return false, err
+	}
+	return true, ttlTable.touch(ttlTable.db, key)
+}
+
+// DeleteIfEquals only deletes the data, but not the timestamp which will be
+// handled by the prune function.
+func (ttlTable *table) DeleteIfEquals(key string, value interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	return ttlTable.db.DeleteIfEquals(ttlTable.keyWithPrefix(key), value)
+}
+
+// CompareAndSwap implements the db.Table interface. The timestamp associated
+// with the key is only recorded if the new value is written.
+func (ttlTable *table) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	ok, err := ttlTable.db.CompareAndSwap(ttlTable.keyWithPrefix(key), old, new)
+	if !ok || err != nil {
+		return false, err
+	}
+	return true, ttlTable.touch(ttlTable.db, key)
+}
+
+// Update implements the db.Table interface. The timestamp associated with the
+// key is recorded in the same txn as the updated value.
+func (ttlTable *table) Update(key string, ptr interface{}, fn func(exists bool) error) error {
+	return db.UpdateTable(ttlTable.db, ttlTable, key, ptr, fn)
+}
+
+// Merge implements the db.Table interface. The timestamp associated with the
+// key is recorded once the value is merged.
+func (ttlTable *table) Merge(key, name string, value interface{}) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
 
-	return ttlTable.db.Delete(ttlTable.keyWithPrefix(key))
+	if err := ttlTable.db.Merge(ttlTable.keyWithPrefix(key), name, value); err != nil {
+		return err
+	}
+	return ttlTable.touch(ttlTable.db, key)
+}
+
+// Increment implements the db.Table interface.
+func (ttlTable *table) Increment(key string, delta int64) error {
+	return ttlTable.Merge(key, db.MergeAdd, delta)
+}
+
+// Clear implements the db.Table interface. The timestamps associated with the
+// keys are deleted along with the data, which also deletes the prune pointer,
+// so the prune pointer is written again. Every slot before the current one is
+// empty, so they are all marked as pruned. Like DeletePrefix, clearing the table
+// can make concurrent writes to the database fail on some drivers, including the
+// writes of the pruner, which are retried on the next interval.
+func (ttlTable *table) Clear() error {
+	if err := ttlTable.db.DeletePrefix(ttlTable.keyWithPrefix("")); err != nil {
+		return err
+	}
+	if err := ttlTable.db.DeletePrefix(ttlTable.nameHash + "-slot"); err != nil {
+		return err
+	}
+	return ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), ttlTable.slotNo(time.Now())-1)
+}
+
+// Drop implements the db.Table interface. The prune pointer is deleted along
+// with everything else, and the table is not pruned again until it is written
+// to, which initializes the prune pointer again. Like Clear, dropping the table
+// can make concurrent writes to the database fail on some drivers.
+func (ttlTable *table) Drop() error {
+	if err := ttlTable.db.DeletePrefix(ttlTable.nameHash); err != nil {
+		return err
+	}
+	if err := db.UnregisterSubTables(ttlTable.db, ttlTable.nameHash); err != nil {
+		return err
+	}
+	if ttlTable.parent == nil {
+		return db.UnregisterTable(ttlTable.db, ttlTable.name)
+	}
+	return db.UnregisterSubTable(ttlTable.db, ttlTable.parent.nameHash, ttlTable.name)
+}
+
+// SubTable implements the db.Table interface. The sub-table is pruned on the
+// same interval as the table, until the context given to New is done. The
+// sub-table is only created the first time it is asked for, and the same
+// sub-table is returned afterwards.
+func (ttlTable *table) SubTable(name string) db.Table {
+	ttlTable.subTablesMu.Lock()
+	defer ttlTable.subTablesMu.Unlock()
+
+	if sub, ok := ttlTable.subTables[name]; ok {
+		return sub
+	}
+	hash := sha3.Sum256([]byte(name))
+	sub := newTable(ttlTable.ctx, ttlTable.db, name, ttlTable.nameHash+"/"+string(hash[:]), ttlTable, ttlTable.pruneInterval)
+	ttlTable.subTables[name] = sub
+	return sub
+}
+
+// SubTableNames implements the db.Table interface.
+func (ttlTable *table) SubTableNames() ([]string, error) {
+	return db.SubTableNames(ttlTable.db, db.SubTableKey(ttlTable.nameHash, ""))
 }
 
 // Size implements the db.Table interface.
 func (ttlTable *table) Size() (int, error) {
-	return ttlTable.db.Size(ttlTable.keyWithPrefix(""))
+	return ttlTable.SizeContext(context.Background())
+}
+
+// Stats implements the db.Table interface. The timestamps associated with the
+// keys are not included.
+func (ttlTable *table) Stats() (db.Stats, error) {
+	return ttlTable.db.Stats(ttlTable.keyWithPrefix(""))
 }
 
 // Iterator implements the db.Table interface.
@@ -78,21 +229,151 @@ func (ttlTable *table) Iterator() db.Iterator {
 	return ttlTable.db.Iterator(ttlTable.keyWithPrefix(""))
 }
 
+// RangeIterator implements the db.Table interface.
+func (ttlTable *table) RangeIterator(start, end string, limit int) db.Iterator {
+	return ttlTable.IteratorWithOptions(db.IteratorOptions{
+		Start: start,
+		End:   end,
+		Limit: limit,
+	})
+}
+
+// IteratorWithOptions implements the db.Table interface.
+func (ttlTable *table) IteratorWithOptions(opts db.IteratorOptions) db.Iterator {
+	return ttlTable.db.IteratorWithOptions(ttlTable.keyWithPrefix(""), opts)
+}
+
+// InsertContext implements the db.Table interface. The context is only checked
+// before writing, because the data and its timestamp are written separately.
+func (ttlTable *table) InsertContext(ctx context.Context, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ttlTable.insert(ttlTable.db, key, value)
+}
+
+// GetContext implements the db.Table interface.
+func (ttlTable *table) GetContext(ctx context.Context, key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	return ttlTable.db.GetContext(ctx, ttlTable.keyWithPrefix(key), value)
+}
+
+// DeleteContext only deletes the data, but not the timestamp which will be
+// handled by the prune function.
+func (ttlTable *table) DeleteContext(ctx context.Context, key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	return ttlTable.db.DeleteContext(ctx, ttlTable.keyWithPrefix(key))
+}
+
+// SizeContext implements the db.Table interface.
+func (ttlTable *table) SizeContext(ctx context.Context) (int, error) {
+	return ttlTable.db.SizeContext(ctx, ttlTable.keyWithPrefix(""))
+}
+
+// IteratorContext implements the db.Table interface.
+func (ttlTable *table) IteratorContext(ctx context.Context, opts db.IteratorOptions) db.Iterator {
+	return ttlTable.db.IteratorContext(ctx, ttlTable.keyWithPrefix(""), opts)
+}
+
+// InsertRaw implements the db.Table interface.
+func (ttlTable *table) InsertRaw(key string, data []byte) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	if err := ttlTable.db.InsertRaw(ttlTable.keyWithPrefix(key), data); err != nil {
+		return fmt.Errorf("error inserting ttl data: %v", err)
+	}
+	return ttlTable.touch(ttlTable.db, key)
+}
+
+// GetRaw implements the db.Table interface.
+func (ttlTable *table) GetRaw(key string) ([]byte, error) {
+	if key == "" {
+		return nil, db.ErrEmptyKey
+	}
+
+	return ttlTable.db.GetRaw(ttlTable.keyWithPrefix(key))
+}
+
+// Scan implements the db.Table interface.
+func (ttlTable *table) Scan(cursor string, limit int) ([]db.Entry, string, error) {
+	return db.ScanTable(ttlTable, cursor, limit)
+}
+
+// NewBatch implements the db.Table interface.
+func (ttlTable *table) NewBatch() db.Batch {
+	return ttlTable.Batch(ttlTable.db.NewBatch())
+}
+
+// Batch implements the db.Table interface. Inserting into the batch also
+// records the timestamp associated with the key in the same batch.
+func (ttlTable *table) Batch(batch db.Batch) db.Batch {
+	return &ttlBatch{
+		batch: batch,
+		table: ttlTable,
+	}
+}
+
+// Txn implements the db.Table interface. Inserting in the txn also records the
+// timestamp associated with the key in the same txn.
+func (ttlTable *table) Txn(txn db.Txn) db.Txn {
+	return &ttlTxn{
+		txn:   txn,
+		table: ttlTable,
+	}
+}
+
+// Snapshot implements the db.Table interface.
+func (ttlTable *table) Snapshot(snapshot db.Snapshot) db.Snapshot {
+	return &ttlSnapshot{
+		snapshot: snapshot,
+		table:    ttlTable,
+	}
+}
+
 // New returns a new ttl wrapper over the given database.
 // The underlying database cannot have any database has a prefix of `ttl_`.
+// The table is pruned until the context is done, or until the database is
+// closed.
 func New(ctx context.Context, database db.DB, name string, pruneInterval time.Duration) db.Table {
 	hash := sha3.Sum256([]byte(name))
+	return newTable(ctx, database, name, string(hash[:]), nil, pruneInterval)
+}
+
+// newTable returns a new ttl table with the given name hash, and starts pruning
+// it. The table is registered in the database, or in its parent if it is a
+// sub-table.
+func newTable(ctx context.Context, database db.DB, name, nameHash string, parent *table, pruneInterval time.Duration) *table {
 	ttlDB := &table{
+		ctx:           ctx,
 		db:            database,
-		nameHash:      string(hash[:]),
+		name:          name,
+		nameHash:      nameHash,
+		parent:        parent,
 		pruneInterval: pruneInterval,
+		subTablesMu:   new(sync.Mutex),
+		subTables:     map[string]*table{},
 	}
 
 	// Initialize the prune pointer if not exist
-	_, err := ttlDB.prunePointer()
+	_, err := ttlDB.initPrunePointer(database)
 	if err != nil {
 		panic(fmt.Sprintf("cannot get prune pointer, err = %v", err))
 	}
+	if parent == nil {
+		err = db.RegisterTable(database, name)
+	} else {
+		err = database.Insert(db.SubTableKey(parent.nameHash, name), []byte{})
+	}
+	if err != nil {
+		panic(fmt.Sprintf("cannot register table, err = %v", err))
+	}
 
 	// NOTE: WE NEED TO TAKE A EXTERNAL CONTEXT TELLING US WHEN TO STOP PRUNING
 	// OR WHEN THE DB IS CLOSING. THIS IS BECAUSE WE NEED TO CREATE AN ITERATOR
@@ -102,40 +383,71 @@ func New(ctx context.Context, database db.DB, name string, pruneInterval time.Du
 }
 
 // prune will periodically prune the underlying database and stores the prune pointer
-// in the db.
+// in the db. It stops quietly once the context is done, or the database has been
+// closed, because the database can be closed while the table is being pruned.
 func (ttlTable *table) runPruneOnInterval(ctx context.Context) {
 	ticker := time.NewTicker(ttlTable.pruneInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
 			pointer, err := ttlTable.prunePointer()
+			if err == db.ErrKeyNotFound {
+				// The table has been dropped, so there is nothing to prune
+				// until it is written to again.
+				continue
+			}
 			if err != nil {
+				if stopped(ctx, err) {
+					return
+				}
 				panic(fmt.Sprintf("cannot read prune pointer, err = %v", err))
 			}
 
-			// TODO: How can we catch the error caused by the underlying db
-			// being closed?
-			if err := ttlTable.prune(pointer); err != nil {
+			if err := ttlTable.prune(ctx, pointer); err != nil {
+				if stopped(ctx, err) {
+					return
+				}
+				// Writes can fail while a prefix of the database is being
+				// deleted, such as when another table is cleared, so the
+				// slots are pruned again on the next tick.
 				log.Println(fmt.Errorf("failed to prune table: %v", err))
-				return
 			}
 		}
 	}
 }
 
-func (ttlTable *table) prune(pointer int64) error {
+// stopped returns whether pruning failed with the given error because the
+// context is done, or because the database has been closed.
+func stopped(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || err == db.ErrClosed
+}
+
+// prune deletes the data in all slots after the given prune pointer that have
+// expired, and then moves the prune pointer. It stops early once the context is
+// done.
+func (ttlTable *table) prune(ctx context.Context, pointer int64) error {
 	// Note: we subtract 1 to ensure pruning is only done on data that has been
 	// around for _at least_ the interval instead of _at most_.
 	newSlotToDelete := ttlTable.slotNo(time.Now().Add(-ttlTable.pruneInterval)) - 1
 	for slot := pointer + 1; slot <= newSlotToDelete; slot++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err := ttlTable.pruneTimeSlot(slot); err != nil {
 			return err
 		}
 	}
-	pointer = newSlotToDelete
-	return ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), newSlotToDelete)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The prune pointer is only moved if it has not changed while pruning, so
+	// that it is not written again after the table is dropped or cleared.
+	_, err := ttlTable.db.CompareAndSwap(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), pointer, newSlotToDelete)
+	return err
 }
 
 func (ttlTable *table) pruneTimeSlot(slot int64) error {
@@ -156,7 +468,7 @@ func (ttlTable *table) pruneTimeSlot(slot int64) error {
 		}
 	}
 
-	return nil
+	return iter.Err()
 }
 
 // slotNo returns the slot number in which the given unix timestamp is belonging to.
@@ -165,17 +477,42 @@ func (ttlTable *table) slotNo(moment time.Time) int64 {
 }
 
 // prunePointer returns the current prune pointer which all slots before or equals to
-// it have been pruned. It will initialize the pointer if the db is new.
+// it have been pruned. It returns db.ErrKeyNotFound if the pointer has not been
+// initialized, or if the table has been dropped.
 func (ttlTable *table) prunePointer() (int64, error) {
 	var pointer int64
 	err := ttlTable.db.Get(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), &pointer)
-	if err == db.ErrKeyNotFound {
-		slot := ttlTable.slotNo(time.Now())
-		return slot - 1, ttlTable.db.Insert(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), slot-1)
-	}
 	return pointer, err
 }
 
+// initPrunePointer returns the current prune pointer. It will initialize the
+// pointer using the given writer if the db is new, or if the table has been
+// dropped, in which case the table is registered again using the same writer.
+func (ttlTable *table) initPrunePointer(w writer) (int64, error) {
+	pointer, err := ttlTable.prunePointer()
+	if err != db.ErrKeyNotFound {
+		return pointer, err
+	}
+	if err := ttlTable.register(w); err != nil {
+		return 0, err
+	}
+	slot := ttlTable.slotNo(time.Now())
+	return slot - 1, w.Insert(ttlTable.keyWithSlotPrefix(PrunePointerKey, 0), slot-1)
+}
+
+// register the table in the db using the given writer, or in its parent if it
+// is a sub-table. The parent is also initialized again, in case it has been
+// dropped along with the sub-table.
+func (ttlTable *table) register(w writer) error {
+	if ttlTable.parent == nil {
+		return db.RegisterTableIn(ttlTable.db, w, ttlTable.name)
+	}
+	if _, err := ttlTable.parent.initPrunePointer(w); err != nil {
+		return err
+	}
+	return w.Insert(db.SubTableKey(ttlTable.parent.nameHash, ttlTable.name), []byte{})
+}
+
 func (ttlTable *table) keyWithSlotPrefix(key string, i int64) string {
 	// Use "-" instead of "_" to distinguish between the actual data and time-slot data.
 	return fmt.Sprintf("%v-slot%d_%v", ttlTable.nameHash, i, key)
@@ -184,3 +521,132 @@ func (ttlTable *table) keyWithSlotPrefix(key string, i int64) string {
 func (ttlTable *table) keyWithPrefix(name string) string {
 	return fmt.Sprintf("%v_%v", ttlTable.nameHash, name)
 }
+
+// ttlBatch is a view of a batch that writes the data, and its timestamp, into
+// the ttl table.
+type ttlBatch struct {
+	batch db.Batch
+	table *table
+}
+
+// Insert implements the db.Batch interface.
+func (batch *ttlBatch) Insert(key string, value interface{}) error {
+	return batch.table.insert(batch.batch, key, value)
+}
+
+// Delete implements the db.Batch interface.
+func (batch *ttlBatch) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return batch.batch.Delete(batch.table.keyWithPrefix(key))
+}
+
+// Len implements the db.Batch interface.
+func (batch *ttlBatch) Len() int {
+	return batch.batch.Len()
+}
+
+// Commit implements the db.Batch interface.
+func (batch *ttlBatch) Commit() error {
+	return batch.batch.Commit()
+}
+
+// ttlTxn is a view of a txn that reads and writes the data, and its timestamp,
+// in the ttl table.
+type ttlTxn struct {
+	txn   db.Txn
+	table *table
+}
+
+// Get implements the db.Txn interface.
+func (txn *ttlTxn) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return txn.txn.Get(txn.table.keyWithPrefix(key), value)
+}
+
+// Insert implements the db.Txn interface.
+func (txn *ttlTxn) Insert(key string, value interface{}) error {
+	return txn.table.insert(txn.txn, key, value)
+}
+
+// Delete implements the db.Txn interface.
+func (txn *ttlTxn) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return txn.txn.Delete(txn.table.keyWithPrefix(key))
+}
+
+// Has implements the db.Txn interface.
+func (txn *ttlTxn) Has(key string) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	return txn.txn.Has(txn.table.keyWithPrefix(key))
+}
+
+// InsertRaw implements the db.Txn interface.
+func (txn *ttlTxn) InsertRaw(key string, data []byte) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	if err := txn.txn.InsertRaw(txn.table.keyWithPrefix(key), data); err != nil {
+		return fmt.Errorf("error inserting ttl data: %v", err)
+	}
+	return txn.table.touch(txn.txn, key)
+}
+
+// GetRaw implements the db.Txn interface.
+func (txn *ttlTxn) GetRaw(key string) ([]byte, error) {
+	if key == "" {
+		return nil, db.ErrEmptyKey
+	}
+	return txn.txn.GetRaw(txn.table.keyWithPrefix(key))
+}
+
+// Iterator implements the db.Txn interface.
+func (txn *ttlTxn) Iterator(prefix string) db.Iterator {
+	return txn.txn.Iterator(txn.table.keyWithPrefix(prefix))
+}
+
+// Commit implements the db.Txn interface.
+func (txn *ttlTxn) Commit() error {
+	return txn.txn.Commit()
+}
+
+// Discard implements the db.Txn interface.
+func (txn *ttlTxn) Discard() {
+	txn.txn.Discard()
+}
+
+// ttlSnapshot is a read-only view of the ttl table in a snapshot.
+type ttlSnapshot struct {
+	snapshot db.Snapshot
+	table    *table
+}
+
+// Get implements the db.Snapshot interface.
+func (snapshot *ttlSnapshot) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	return snapshot.snapshot.Get(snapshot.table.keyWithPrefix(key), value)
+}
+
+// Size implements the db.Snapshot interface.
+func (snapshot *ttlSnapshot) Size(prefix string) (int, error) {
+	return snapshot.snapshot.Size(snapshot.table.keyWithPrefix(prefix))
+}
+
+// Iterator implements the db.Snapshot interface.
+func (snapshot *ttlSnapshot) Iterator(prefix string) db.Iterator {
+	return snapshot.snapshot.Iterator(snapshot.table.keyWithPrefix(prefix))
+}
+
+// Release implements the db.Snapshot interface.
+func (snapshot *ttlSnapshot) Release() {
+	snapshot.snapshot.Release()
+}
@@ -27,14 +27,24 @@ var _ = Describe("TTL cache", func() {
 		err := table.Get(key, &val)
 		Expect(err).Should(Equal(db.ErrKeyNotFound))
 
+		ok, err := table.Has(key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).Should(BeFalse())
+
 		// Should be able to read the value after inserting.
 		Expect(table.Insert(key, value)).NotTo(HaveOccurred())
+		ok, err = table.Has(key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).Should(BeTrue())
 		err = table.Get(key, &val)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(reflect.DeepEqual(val, value)).Should(BeTrue())
 
 		// Expect no value exists after deleting the value.
 		Expect(table.Delete(key)).NotTo(HaveOccurred())
+		ok, err = table.Has(key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).Should(BeFalse())
 		err = table.Get(key, &val)
 		Expect(err).Should(Equal(db.ErrKeyNotFound))
 		return true
@@ -253,6 +263,152 @@ var _ = Describe("TTL cache", func() {
 					Expect(quick.Check(readAndWrite, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
 				})
 
+				It("should eventually prune the data written by an update", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+
+					table := New(ctx, database, "name", 50*time.Millisecond)
+					value := testutil.RandomTestStruct()
+					Expect(table.Update("key", &value, func(exists bool) error {
+						Expect(exists).Should(BeFalse())
+						return nil
+					})).NotTo(HaveOccurred())
+
+					newValue := testutil.TestStruct{D: []byte{}}
+					Expect(table.Get("key", &newValue)).NotTo(HaveOccurred())
+					Expect(reflect.DeepEqual(value, newValue)).Should(BeTrue())
+
+					Eventually(func() error {
+						return table.Get("key", &newValue)
+					}, time.Second, 50*time.Millisecond).Should(Equal(db.ErrKeyNotFound))
+				})
+
+				It("should eventually prune the data in sub-tables", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+
+					table := New(ctx, database, "name", 50*time.Millisecond)
+					sub := table.SubTable("sub")
+					// Sub-tables are only created, and pruned, once.
+					Expect(table.SubTable("sub")).To(BeIdenticalTo(sub))
+					Expect(sub.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+					names, err := table.SubTableNames()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(names).To(Equal([]string{"sub"}))
+					size, err := table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).To(Equal(0))
+
+					Eventually(func() int {
+						size, err := sub.Size()
+						Expect(err).NotTo(HaveOccurred())
+						return size
+					}, time.Second, 50*time.Millisecond).Should(Equal(0))
+				})
+
+				It("should delete the timestamps when the table is cleared", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+
+					table := New(ctx, database, "name", time.Minute)
+					for i := 0; i < 10; i++ {
+						Expect(table.Insert(fmt.Sprintf("%v", i), testutil.RandomTestStruct())).NotTo(HaveOccurred())
+					}
+					Expect(table.Clear()).NotTo(HaveOccurred())
+
+					size, err := table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).To(Equal(0))
+					// Only the prune pointer of the table is left.
+					size, err = database.Size("")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).To(Equal(1))
+					tables, err := db.ListTables(database)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(tables).To(HaveLen(1))
+					Expect(tables[0].Name).To(Equal("name"))
+
+					// The table can still be used after being cleared, including
+					// in txns.
+					Expect(table.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+					value := uint64(0)
+					Expect(table.Update("counter", &value, func(exists bool) error {
+						Expect(exists).To(BeFalse())
+						value = 1
+						return nil
+					})).NotTo(HaveOccurred())
+					size, err = table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).To(Equal(2))
+				})
+
+				It("should not write anything once the table is dropped", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+
+					table := New(ctx, database, "name", 50*time.Millisecond)
+					for i := 0; i < 10; i++ {
+						Expect(table.Insert(fmt.Sprintf("%v", i), testutil.RandomTestStruct())).NotTo(HaveOccurred())
+					}
+					Expect(table.Drop()).NotTo(HaveOccurred())
+
+					// Wait for the table to be pruned a few times.
+					time.Sleep(200 * time.Millisecond)
+					size, err := database.Size("")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).To(Equal(0))
+
+					// The table is registered, and pruned, again once it is
+					// written to.
+					Expect(table.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+					tables, err := db.ListTables(database)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(tables).To(HaveLen(1))
+					Expect(tables[0].Name).To(Equal("name"))
+					Eventually(func() int {
+						size, err := table.Size()
+						Expect(err).NotTo(HaveOccurred())
+						return size
+					}, time.Second, 50*time.Millisecond).Should(Equal(0))
+				})
+
+				It("should register a sub-table again once it is written to after its parent is dropped", func() {
+					database := initializer(codec)
+					defer database.Close()
+
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+
+					table := New(ctx, database, "name", time.Minute)
+					sub := table.SubTable("sub")
+					Expect(sub.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+					Expect(table.Drop()).NotTo(HaveOccurred())
+					tables, err := db.ListTables(database)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(tables).To(BeEmpty())
+
+					Expect(sub.Insert("key", testutil.RandomTestStruct())).NotTo(HaveOccurred())
+					tables, err = db.ListTables(database)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(tables).To(HaveLen(1))
+					Expect(tables[0].Name).To(Equal("name"))
+					names, err := table.SubTableNames()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(names).To(Equal([]string{"sub"}))
+				})
+
 				It("should not prune if the same key is added again before the interval expires", func() {
 					database := initializer(codec)
 					defer database.Close()
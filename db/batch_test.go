@@ -0,0 +1,128 @@
+package db_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("batch", func() {
+	for i := range testutil.Codecs {
+		for j := range testutil.DbInitalizer {
+			codec := testutil.Codecs[i]
+			initializer := testutil.DbInitalizer[j]
+
+			Context("when writing a batch into the db", func() {
+				It("should only write the key/value pairs after committing", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(name string, values []testutil.TestStruct) bool {
+						batch := db.NewBatch()
+						for i, value := range values {
+							Expect(batch.Insert(fmt.Sprintf("%v%v", name, i), value)).Should(Succeed())
+						}
+						Expect(batch.Len()).Should(Equal(len(values)))
+
+						// Nothing should be written before committing.
+						size, err := db.Size(name)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(size).Should(BeZero())
+
+						Expect(batch.Commit()).Should(Succeed())
+						Expect(batch.Len()).Should(BeZero())
+						for i, value := range values {
+							stored := testutil.TestStruct{D: []byte{}}
+							Expect(db.Get(fmt.Sprintf("%v%v", name, i), &stored)).Should(Succeed())
+							Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+						}
+
+						// Delete everything using the same batch.
+						for i := range values {
+							Expect(batch.Delete(fmt.Sprintf("%v%v", name, i))).Should(Succeed())
+						}
+						Expect(batch.Commit()).Should(Succeed())
+						size, err = db.Size(name)
+						Expect(err).NotTo(HaveOccurred())
+						return size == 0
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should apply writes in the order they were added", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value testutil.TestStruct) bool {
+						if key == "" {
+							return true
+						}
+						batch := db.NewBatch()
+						Expect(batch.Insert(key, value)).Should(Succeed())
+						Expect(batch.Delete(key)).Should(Succeed())
+						Expect(batch.Commit()).Should(Succeed())
+
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(db.Get(key, &stored)).Should(Equal(ErrKeyNotFound))
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should return ErrEmptyKey when writing an empty key", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					batch := db.NewBatch()
+					Expect(batch.Insert("", testutil.RandomTestStruct())).Should(Equal(ErrEmptyKey))
+					Expect(batch.Delete("")).Should(Equal(ErrEmptyKey))
+					Expect(batch.Len()).Should(BeZero())
+				})
+			})
+
+			Context("when writing a batch across multiple tables", func() {
+				It("should commit the writes of all tables atomically", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value, other testutil.TestStruct) bool {
+						first := NewTable(db, "first")
+						second := NewTable(db, "second")
+
+						batch := db.NewBatch()
+						Expect(first.Batch(batch).Insert(key, value)).Should(Succeed())
+						Expect(second.Batch(batch).Insert(key, other)).Should(Succeed())
+						Expect(batch.Len()).Should(Equal(2))
+
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(first.Get(key, &stored)).Should(Equal(ErrKeyNotFound))
+						Expect(batch.Commit()).Should(Succeed())
+
+						Expect(first.Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+						stored = testutil.TestStruct{D: []byte{}}
+						Expect(second.Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, other)).Should(BeTrue())
+
+						tableBatch := first.NewBatch()
+						Expect(tableBatch.Delete(key)).Should(Succeed())
+						Expect(tableBatch.Commit()).Should(Succeed())
+						Expect(first.Get(key, &stored)).Should(Equal(ErrKeyNotFound))
+						Expect(second.Delete(key)).Should(Succeed())
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+			})
+		}
+	}
+})
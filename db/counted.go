@@ -0,0 +1,370 @@
+package db
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrBatchNotCounted is returned when writing to a view of a counted Table in
+// a Batch of another Table. Batches cannot read keys, so the writes cannot be
+// counted. Use the NewBatch method of the counted Table instead.
+var ErrBatchNotCounted = errors.New("batch writes to a counted table cannot be counted")
+
+// A CountedTable is a Table that maintains the number of key/value pairs in
+// it, so that Size takes constant time instead of iterating over every key.
+// The count is written in the same Txn as every insert and delete, so it stays
+// exact even when the Table is written concurrently. The cost is that writes
+// to a CountedTable always happen in Txns, and every write reads and writes
+// the count, so concurrent writes are retried more often. Sub-tables of a
+// CountedTable are not counted.
+type CountedTable interface {
+	Table
+
+	// Recount the key/value pairs in the Table from scratch, and store the
+	// count. It returns the new count. This repairs the count if the Table has
+	// been written without being counted, for example by a Table of the same
+	// name that was created using NewTable.
+	Recount() (int, error)
+}
+
+type countedTable struct {
+	*table
+	countKey string
+}
+
+// NewCountedTable creates a new CountedTable with the given name. It shares
+// its key/value pairs with the Table of the same name created using NewTable,
+// but writes to that Table are not counted. If the count has never been
+// stored, then it is recounted. Writes to a CountedTable happen in Txns, so it
+// is registered in the DB when it is created, instead of when it is first
+// written.
+func NewCountedTable(db DB, name string) (CountedTable, error) {
+	t := NewTable(db, name).(*table)
+	counted := &countedTable{
+		table:    t,
+		countKey: t.nameHash + "-count",
+	}
+	if err := t.register(); err != nil {
+		return nil, err
+	}
+	ok, err := db.Has(counted.countKey)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if _, err := counted.Recount(); err != nil {
+			return nil, err
+		}
+	}
+	return counted, nil
+}
+
+func (t *countedTable) Insert(key string, value interface{}) error {
+	return t.InsertContext(context.Background(), key, value)
+}
+
+func (t *countedTable) Delete(key string) error {
+	return t.DeleteContext(context.Background(), key)
+}
+
+func (t *countedTable) InsertIfAbsent(key string, value interface{}) (bool, error) {
+	ok := false
+	err := runTxn(t.db, func(txn Txn) error {
+		view := t.Txn(txn)
+		exists, err := view.Has(key)
+		if ok = !exists; exists || err != nil {
+			return err
+		}
+		return view.Insert(key, value)
+	})
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+func (t *countedTable) DeleteIfEquals(key string, value interface{}) (bool, error) {
+	ok := false
+	err := runTxn(t.db, func(txn Txn) error {
+		view := t.Txn(txn)
+		data, err := view.GetRaw(key)
+		if err == ErrKeyNotFound {
+			ok = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ok, err = EqualValue(t.db.Codec(), data, value); !ok || err != nil {
+			return err
+		}
+		return view.Delete(key)
+	})
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+func (t *countedTable) Merge(key, name string, value interface{}) error {
+	return runTxn(t.db, func(txn Txn) error {
+		view := t.Txn(txn)
+		existing, err := view.GetRaw(key)
+		if err != nil && err != ErrKeyNotFound {
+			return err
+		}
+		data, err := MergeValue(t.db.Codec(), name, existing, value)
+		if err != nil {
+			return err
+		}
+		return view.InsertRaw(key, data)
+	})
+}
+
+func (t *countedTable) Increment(key string, delta int64) error {
+	return t.Merge(key, MergeAdd, delta)
+}
+
+func (t *countedTable) Update(key string, ptr interface{}, fn func(exists bool) error) error {
+	return UpdateTable(t.db, t, key, ptr, fn)
+}
+
+func (t *countedTable) Clear() error {
+	if err := t.table.Clear(); err != nil {
+		return err
+	}
+	_, err := t.Recount()
+	return err
+}
+
+func (t *countedTable) Drop() error {
+	if err := t.table.Drop(); err != nil {
+		return err
+	}
+	return t.db.Delete(t.countKey)
+}
+
+func (t *countedTable) Size() (int, error) {
+	return t.SizeContext(context.Background())
+}
+
+func (t *countedTable) SizeContext(ctx context.Context) (int, error) {
+	var count int64
+	if err := t.db.GetContext(ctx, t.countKey, &count); err != nil {
+		if err == ErrKeyNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return int(count), nil
+}
+
+func (t *countedTable) InsertContext(ctx context.Context, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return runTxn(t.db, func(txn Txn) error {
+		return t.Txn(txn).Insert(key, value)
+	})
+}
+
+func (t *countedTable) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return runTxn(t.db, func(txn Txn) error {
+		return t.Txn(txn).Delete(key)
+	})
+}
+
+func (t *countedTable) InsertRaw(key string, data []byte) error {
+	return runTxn(t.db, func(txn Txn) error {
+		return t.Txn(txn).InsertRaw(key, data)
+	})
+}
+
+func (t *countedTable) Scan(cursor string, limit int) ([]Entry, string, error) {
+	return ScanTable(t, cursor, limit)
+}
+
+func (t *countedTable) NewBatch() Batch {
+	return &countedBatch{table: t}
+}
+
+func (t *countedTable) Batch(batch Batch) Batch {
+	return &uncountedBatch{batch: batch}
+}
+
+func (t *countedTable) Txn(txn Txn) Txn {
+	return &countedTxn{
+		Txn:   t.table.Txn(txn),
+		txn:   txn,
+		table: t,
+	}
+}
+
+func (t *countedTable) Recount() (int, error) {
+	count := 0
+	err := runTxn(t.db, func(txn Txn) error {
+		// The count is read, even though it is overwritten, so that the Txn
+		// conflicts with counted writes that are committed while recounting.
+		var stored int64
+		if err := txn.Get(t.countKey, &stored); err != nil && err != ErrKeyNotFound {
+			return err
+		}
+
+		count = 0
+		iter := txn.Iterator(t.keyWithPrefix(""))
+		defer iter.Close()
+		for iter.Next() {
+			count++
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+		return txn.Insert(t.countKey, int64(count))
+	})
+	return count, err
+}
+
+// countedTxn is a view of a Txn that updates the count of a counted table,
+// in the same Txn, whenever a key is inserted into, or deleted from, the
+// table.
+type countedTxn struct {
+	Txn
+	txn   Txn
+	table *countedTable
+}
+
+func (txn *countedTxn) Insert(key string, value interface{}) error {
+	return txn.write(key, true, func() error {
+		return txn.Txn.Insert(key, value)
+	})
+}
+
+func (txn *countedTxn) InsertRaw(key string, data []byte) error {
+	return txn.write(key, true, func() error {
+		return txn.Txn.InsertRaw(key, data)
+	})
+}
+
+func (txn *countedTxn) Delete(key string) error {
+	return txn.write(key, false, func() error {
+		return txn.Txn.Delete(key)
+	})
+}
+
+// write runs the write of the key, and updates the count if the write changes
+// whether the key exists.
+func (txn *countedTxn) write(key string, insert bool, f func() error) error {
+	exists, err := txn.Txn.Has(key)
+	if err != nil {
+		return err
+	}
+	if err := f(); err != nil {
+		return err
+	}
+	if exists == insert {
+		return nil
+	}
+
+	var count int64
+	if err := txn.txn.Get(txn.table.countKey, &count); err != nil && err != ErrKeyNotFound {
+		return err
+	}
+	if insert {
+		count++
+	} else {
+		count--
+	}
+	return txn.txn.Insert(txn.table.countKey, count)
+}
+
+// countedBatch is a Batch of writes to a counted table. The writes are
+// buffered, and written in one Txn when the Batch is committed, so that they
+// can be counted.
+//
+// NOTE: The writes are not split across Txns, because the Batch must be
+// committed atomically. Every write also reads and writes the count, so a
+// Batch that does not fit into a single Txn of the DB fails to commit, and
+// nothing is written. BadgerDB limits the size of a Txn, and fails with
+// `badger.ErrTxnTooBig`, so large Batches must be split by the caller.
+type countedBatch struct {
+	table  *countedTable
+	writes []countedWrite
+}
+
+type countedWrite struct {
+	key    string
+	data   []byte
+	delete bool
+}
+
+func (batch *countedBatch) Insert(key string, value interface{}) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	data, err := batch.table.db.Codec().Encode(value)
+	if err != nil {
+		return err
+	}
+	batch.writes = append(batch.writes, countedWrite{key: key, data: data})
+	return nil
+}
+
+func (batch *countedBatch) Delete(key string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	batch.writes = append(batch.writes, countedWrite{key: key, delete: true})
+	return nil
+}
+
+func (batch *countedBatch) Len() int {
+	return len(batch.writes)
+}
+
+func (batch *countedBatch) Commit() error {
+	err := runTxn(batch.table.db, func(txn Txn) error {
+		view := batch.table.Txn(txn)
+		for _, w := range batch.writes {
+			if w.delete {
+				if err := view.Delete(w.key); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := view.InsertRaw(w.key, w.data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	batch.writes = batch.writes[:0]
+	return nil
+}
+
+// uncountedBatch is a view of a Batch of another table. Writes to a counted
+// table cannot be counted in the Batch, so they always fail.
+type uncountedBatch struct {
+	batch Batch
+}
+
+func (batch *uncountedBatch) Insert(key string, value interface{}) error {
+	return ErrBatchNotCounted
+}
+
+func (batch *uncountedBatch) Delete(key string) error {
+	return ErrBatchNotCounted
+}
+
+func (batch *uncountedBatch) Len() int {
+	return batch.batch.Len()
+}
+
+func (batch *uncountedBatch) Commit() error {
+	return batch.batch.Commit()
+}
@@ -0,0 +1,156 @@
+package db_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/testutil"
+	"github.com/renproject/phi"
+)
+
+var _ = Describe("counted table", func() {
+	for i := range testutil.Codecs {
+		for j := range testutil.DbInitalizer {
+			codec := testutil.Codecs[i]
+			initializer := testutil.DbInitalizer[j]
+
+			Context("when writing to a counted table", func() {
+				It("should count new keys, but not overwritten keys", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(ops []uint8) bool {
+						table, err := NewCountedTable(db, "counted")
+						Expect(err).NotTo(HaveOccurred())
+						defer func() {
+							Expect(table.Drop()).Should(Succeed())
+						}()
+
+						keys := map[string]bool{}
+						for _, op := range ops {
+							key := fmt.Sprintf("%v", op%8)
+							switch op % 6 {
+							case 0:
+								Expect(table.Insert(key, int64(op))).Should(Succeed())
+								keys[key] = true
+							case 1:
+								Expect(table.Delete(key)).Should(Succeed())
+								delete(keys, key)
+							case 2:
+								ok, err := table.InsertIfAbsent(key, int64(op))
+								Expect(err).NotTo(HaveOccurred())
+								Expect(ok).Should(Equal(!keys[key]))
+								keys[key] = true
+							case 3:
+								var value int64
+								if err := table.Get(key, &value); err == nil {
+									ok, err := table.DeleteIfEquals(key, value)
+									Expect(err).NotTo(HaveOccurred())
+									Expect(ok).Should(BeTrue())
+									delete(keys, key)
+								}
+							case 4:
+								Expect(table.Increment(key, 1)).Should(Succeed())
+								keys[key] = true
+							case 5:
+								batch := table.NewBatch()
+								Expect(batch.Insert(key, int64(op))).Should(Succeed())
+								Expect(batch.Delete(key + "x")).Should(Succeed())
+								Expect(batch.Commit()).Should(Succeed())
+								keys[key] = true
+							}
+
+							size, err := table.Size()
+							Expect(err).NotTo(HaveOccurred())
+							Expect(size).Should(Equal(len(keys)))
+						}
+
+						count, err := table.Recount()
+						Expect(err).NotTo(HaveOccurred())
+						return count == len(keys)
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should count keys exactly when written concurrently", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table, err := NewCountedTable(db, "counted")
+					Expect(err).NotTo(HaveOccurred())
+					phi.ParForAll(10, func(i int) {
+						defer GinkgoRecover()
+
+						for j := 0; j < 20; j++ {
+							key := fmt.Sprintf("%v", rand.Intn(30))
+							if j%3 == 2 {
+								Expect(table.Delete(key)).Should(Succeed())
+								continue
+							}
+							Expect(table.Insert(key, int64(i))).Should(Succeed())
+						}
+					})
+
+					size, err := table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					count, err := table.Recount()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(count))
+				})
+
+				It("should not allow writes in a batch of another table", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table, err := NewCountedTable(db, "counted")
+					Expect(err).NotTo(HaveOccurred())
+					batch := NewTable(db, "other").NewBatch()
+					Expect(table.Batch(batch).Insert("key", int64(1))).Should(Equal(ErrBatchNotCounted))
+					Expect(table.Batch(batch).Delete("key")).Should(Equal(ErrBatchNotCounted))
+				})
+			})
+
+			Context("when the table has been written without being counted", func() {
+				It("should repair the count by recounting", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					uncounted := NewTable(db, "counted")
+					for i := 0; i < 10; i++ {
+						Expect(uncounted.Insert(fmt.Sprintf("%v", i), int64(i))).Should(Succeed())
+					}
+
+					// The count is recounted when it has never been stored.
+					table, err := NewCountedTable(db, "counted")
+					Expect(err).NotTo(HaveOccurred())
+					size, err := table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(10))
+
+					Expect(uncounted.Insert("10", int64(10))).Should(Succeed())
+					size, err = table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(10))
+
+					count, err := table.Recount()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(count).Should(Equal(11))
+					size, err = table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(11))
+
+					Expect(table.Clear()).Should(Succeed())
+					size, err = table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(0))
+				})
+			})
+		}
+	}
+})
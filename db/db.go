@@ -1,7 +1,10 @@
 package db
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"reflect"
 )
 
 // ErrKeyNotFound is returned when there is no value associated with a key.
@@ -14,6 +17,23 @@ var ErrEmptyKey = errors.New("key cannot be empty")
 // range.
 var ErrIndexOutOfRange = errors.New("iterator index out of range")
 
+// ErrConflict is returned when a Txn cannot be committed, because a key that
+// it read has been modified since the Txn was created. The Txn has no effect,
+// and can be retried.
+var ErrConflict = errors.New("transaction conflict")
+
+// ErrTxnDone is returned when using a Txn that has already been committed or
+// discarded.
+var ErrTxnDone = errors.New("transaction already committed or discarded")
+
+// ErrClosed is returned when a DB, or a Txn, Snapshot or Iterator of it, is
+// used after the DB has been closed.
+var ErrClosed = errors.New("db closed")
+
+// ErrInvalidCursor is returned when a scan cursor was not returned by a
+// previous scan.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 // Codec can do encoding/decoding between arbitrary data object and bytes.
 type Codec interface {
 
@@ -26,15 +46,50 @@ type Codec interface {
 	Decode(data []byte, value interface{}) error
 }
 
+// EqualValue returns whether the data, which has been encoded using the Codec,
+// is equal to the value. Encodings are not always deterministic (for example,
+// gob encodes maps in a random order), so if the encodings are different then
+// both are decoded and compared using `reflect.DeepEqual`.
+func EqualValue(codec Codec, data []byte, value interface{}) (bool, error) {
+	encoded, err := codec.Encode(value)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(encoded, data) {
+		return true, nil
+	}
+	if value == nil {
+		return false, nil
+	}
+
+	expected := reflect.New(reflect.TypeOf(value))
+	if err := codec.Decode(encoded, expected.Interface()); err != nil {
+		return false, err
+	}
+
+	// Data that cannot be decoded into the type of the value is not equal to
+	// the value.
+	actual := reflect.New(reflect.TypeOf(value))
+	if err := codec.Decode(data, actual.Interface()); err != nil {
+		return false, nil
+	}
+	return reflect.DeepEqual(expected.Elem().Interface(), actual.Elem().Interface()), nil
+}
+
 // DB is a key-value database which requires the key to be a string and the
 // value can be encoded/decoded by the codec. It allows user to maintain
-// multiple tables with the same underlying database driver.
+// multiple tables with the same underlying database driver. Reads and deletes
+// of a prefix that is shorter than ReservedPrefix, such as the empty prefix,
+// skip the reserved key-space in which Tables are registered.
 type DB interface {
 
 	// Close the DB and free all of its resources. The DB must not be used after
 	// being closed.
 	Close() error
 
+	// Codec returns the Codec that is used to encode and decode values.
+	Codec() Codec
+
 	// Insert writes the key-value into the DB.
 	Insert(key string, value interface{}) error
 
@@ -46,16 +101,247 @@ type DB interface {
 	// Delete the value with the given key from the DB.
 	Delete(key string) error
 
+	// Has returns whether there is a value associated with the given key,
+	// without reading or decoding the value.
+	Has(key string) (bool, error)
+
+	// InsertIfAbsent writes the key-value into the DB if, and only if, there
+	// is no value associated with the key. It returns whether the key-value
+	// was written.
+	InsertIfAbsent(key string, value interface{}) (bool, error)
+
+	// DeleteIfEquals deletes the value with the given key from the DB if, and
+	// only if, it is equal to the given value. It returns whether the value
+	// was deleted. Values are compared using EqualValue.
+	DeleteIfEquals(key string, value interface{}) (bool, error)
+
+	// CompareAndSwap writes the new value for the given key if, and only if,
+	// the current value is equal to the old value. It returns whether the new
+	// value was written. Values are compared using EqualValue.
+	CompareAndSwap(key string, old, new interface{}) (bool, error)
+
+	// Merge atomically merges the value into the value associated with the
+	// given key, using the MergeFunc registered with the given name. If there
+	// is no value associated with the key, then the value is written as it is.
+	// If no MergeFunc is registered with the name, then ErrUnknownMergeFunc is
+	// returned.
+	Merge(key, name string, value interface{}) error
+
+	// DeletePrefix deletes all of the key/value pairs in the DB where the key
+	// begins with the given prefix. Drivers can delete the key/value pairs in
+	// multiple steps, so key/value pairs written with the prefix while they are
+	// being deleted may, or may not, be deleted. Some drivers block all writes
+	// while the key/value pairs are being deleted, so concurrent writes to any
+	// key can also fail with an error, and must be retried by the caller.
+	DeletePrefix(prefix string) error
+
 	// Size returns the number of key/value pairs in the DB where the key begins
 	// with the given prefix.
 	Size(prefix string) (int, error)
 
+	// Stats returns statistics about the key/value pairs in the DB where the
+	// key begins with the given prefix. Like Size, it can iterate over every
+	// key with the prefix.
+	Stats(prefix string) (Stats, error)
+
 	// Iterator over the key/value pairs in the DB where the key begins with the
-	// given prefix.
+	// given prefix. The key/value pairs are iterated in lexicographic order of
+	// their keys.
 	Iterator(prefix string) Iterator
+
+	// IteratorWithOptions returns an Iterator over the key/value pairs in the DB
+	// where the key begins with the given prefix. The options are interpreted
+	// relative to the prefix.
+	IteratorWithOptions(prefix string, opts IteratorOptions) Iterator
+
+	// InsertContext is like Insert, but returns the error of the context,
+	// without writing, if the context is done.
+	InsertContext(ctx context.Context, key string, value interface{}) error
+
+	// GetContext is like Get, but returns the error of the context, without
+	// reading, if the context is done.
+	GetContext(ctx context.Context, key string, value interface{}) error
+
+	// DeleteContext is like Delete, but returns the error of the context,
+	// without deleting, if the context is done.
+	DeleteContext(ctx context.Context, key string) error
+
+	// SizeContext is like Size, but stops counting and returns the error of
+	// the context once the context is done.
+	SizeContext(ctx context.Context, prefix string) (int, error)
+
+	// IteratorContext is like IteratorWithOptions, but the Iterator stops once
+	// the context is done, after which its Err method returns the error of the
+	// context.
+	IteratorContext(ctx context.Context, prefix string, opts IteratorOptions) Iterator
+
+	// InsertRaw writes the key-value into the DB without encoding the value
+	// using the Codec.
+	InsertRaw(key string, data []byte) error
+
+	// GetRaw returns the value associated with the given key without decoding
+	// it using the Codec. If the key cannot be found, then ErrKeyNotFound is
+	// returned.
+	GetRaw(key string) ([]byte, error)
+
+	// NewBatch returns an empty Batch that can be used to write multiple
+	// key/value pairs into the DB atomically.
+	NewBatch() Batch
+
+	// NewTxn returns a new read/write Txn. The Txn must be committed, or
+	// discarded, to release its resources.
+	NewTxn() (Txn, error)
+
+	// Snapshot returns a read-only view of the DB at the current point in time.
+	// Writes to the DB after the Snapshot is taken are not observed by the
+	// Snapshot. The Snapshot must be released when it is no longer needed.
+	Snapshot() (Snapshot, error)
 }
 
-// Iterator is used to iterate through the data in the store.
+// Stats about the key/value pairs in a DB where the key begins with a prefix.
+type Stats struct {
+
+	// Keys is the number of key/value pairs.
+	Keys int
+
+	// KeyBytes is the total size of the keys, including the prefix.
+	KeyBytes int64
+
+	// ValueBytes is the total size of the values, as encoded by the Codec.
+	ValueBytes int64
+
+	// DiskBytes is the approximate amount of storage used by the key/value
+	// pairs, including the overhead of the driver. It depends on the driver,
+	// and on when the driver last wrote to disk, so it is only meant for
+	// capacity planning.
+	DiskBytes int64
+}
+
+// IteratorOptions restrict the key/value pairs that are returned by an
+// Iterator. Keys in the options do not include the iteration prefix.
+type IteratorOptions struct {
+
+	// Start is the inclusive lower bound of the keys. If it is empty, then the
+	// keys are not bounded from below.
+	Start string
+
+	// End is the exclusive upper bound of the keys. If it is empty, then the
+	// keys are not bounded from above.
+	End string
+
+	// Limit is the maximum number of key/value pairs returned by the Iterator.
+	// If it is zero, or negative, then the number is not limited.
+	Limit int
+
+	// Reverse iterates over the key/value pairs in reverse lexicographic order
+	// of their keys, starting from the largest key in the range. Combined with
+	// a Limit, this returns the last key/value pairs in the range.
+	Reverse bool
+}
+
+// Batch is a group of inserts and deletes that are written to the DB
+// atomically when the Batch is committed. Either all of the writes land, or
+// none of them do. A Batch is not safe for concurrent use.
+type Batch interface {
+
+	// Insert adds a write of the key-value to the Batch. The value is encoded
+	// immediately, so encoding errors are returned here instead of on Commit.
+	Insert(key string, value interface{}) error
+
+	// Delete adds a deletion of the given key to the Batch.
+	Delete(key string) error
+
+	// Len returns the number of writes in the Batch, not counting writes to
+	// the reserved key-space, such as the registration of Tables that are
+	// written in the Batch.
+	Len() int
+
+	// Commit applies all writes in the Batch to the DB atomically, in the order
+	// they were added. The Batch is reset after a successful commit and can be
+	// reused.
+	Commit() error
+}
+
+// Txn is a read/write transaction over multiple keys. Reads in a Txn observe
+// its own writes, and writes are only visible to others after the Txn has been
+// committed. If a key read by the Txn has been modified by someone else before
+// the Txn is committed, then committing returns ErrConflict. A Txn is not safe
+// for concurrent use, and it must not be used after it is done.
+//
+// Drivers have different concurrency models. The in-memory and BadgerDB
+// drivers read from a snapshot taken when the Txn is created, so the reads of
+// a Txn are always consistent, and detect conflicts optimistically, allowing
+// many Txns to run concurrently. The LevelDB driver only allows one Txn at a time, and blocks
+// all other writes to the DB until the Txn is done, so it never conflicts.
+type Txn interface {
+
+	// Get the value associated with the given key and write it to the value
+	// interface. The value interface must be a pointer. If the key cannot be
+	// found, then ErrKeyNotFound is returned.
+	Get(key string, value interface{}) error
+
+	// Insert writes the key-value into the Txn.
+	Insert(key string, value interface{}) error
+
+	// Delete the value with the given key in the Txn.
+	Delete(key string) error
+
+	// Has returns whether there is a value associated with the given key in
+	// the Txn, without reading or decoding the value. The key is read by the
+	// Txn, so it conflicts with writes to the key.
+	Has(key string) (bool, error)
+
+	// InsertRaw writes the key-value into the Txn without encoding the value
+	// using the Codec.
+	InsertRaw(key string, data []byte) error
+
+	// GetRaw returns the value associated with the given key in the Txn
+	// without decoding it using the Codec. If the key cannot be found, then
+	// ErrKeyNotFound is returned.
+	GetRaw(key string) ([]byte, error)
+
+	// Iterator over the key/value pairs in the Txn where the key begins with
+	// the given prefix. The Iterator must be closed before the Txn is committed
+	// or discarded, and only one Iterator can be open at a time.
+	Iterator(prefix string) Iterator
+
+	// Commit the writes in the Txn to the DB atomically. If the Txn conflicts
+	// with another write, then ErrConflict is returned and nothing is written.
+	Commit() error
+
+	// Discard the Txn without writing anything to the DB. Discarding a Txn that
+	// is already done has no effect, so it is safe to defer a call to Discard
+	// after creating a Txn.
+	Discard()
+}
+
+// Snapshot is a read-only view of a DB at a point in time. Multiple reads from
+// a Snapshot are consistent with each other, even if the DB is being written
+// concurrently. A Snapshot is safe for concurrent use.
+type Snapshot interface {
+
+	// Get the value associated with the given key and write it to the value
+	// interface. The value interface must be a pointer. If the key cannot be
+	// found, then ErrKeyNotFound is returned.
+	Get(key string, value interface{}) error
+
+	// Size returns the number of key/value pairs in the Snapshot where the key
+	// begins with the given prefix.
+	Size(prefix string) (int, error)
+
+	// Iterator over the key/value pairs in the Snapshot where the key begins
+	// with the given prefix.
+	Iterator(prefix string) Iterator
+
+	// Release the resources associated with the Snapshot. All Iterators must be
+	// closed before the Snapshot is released, and the Snapshot must not be used
+	// after being released. Releasing a Snapshot more than once has no effect.
+	Release()
+}
+
+// Iterator is used to iterate through the data in the store. All drivers
+// iterate over key/value pairs in lexicographic (byte-wise) order of their
+// keys, and return keys with the iteration prefix removed.
 type Iterator interface {
 
 	// Next will progress the iterator to the next element. If there are more
@@ -63,6 +349,22 @@ type Iterator interface {
 	// return false.
 	Next() bool
 
+	// Seek moves the iterator to the first key-value tuple at, or after, the
+	// key in the direction of iteration (for a reverse iterator, this is the
+	// last key-value tuple at, or before, the key). The key is relative to the
+	// prefix of the iterator. It returns true if there is such a key-value
+	// tuple in the range of the iterator, otherwise it returns false. The limit
+	// of the iterator is counted from the tuple that has been seeked.
+	Seek(key string) bool
+
+	// First moves the iterator to the key-value tuple with the smallest key in
+	// the range of the iterator. It returns false if the range is empty.
+	First() bool
+
+	// Last moves the iterator to the key-value tuple with the largest key in
+	// the range of the iterator. It returns false if the range is empty.
+	Last() bool
+
 	// Key of the current key-value tuple. Calling Key() without calling Next()
 	// or when no next item in the iter may result in `ErrIndexOutOfRange`
 	Key() (string, error)
@@ -72,8 +374,19 @@ type Iterator interface {
 	// `ErrIndexOutOfRange`
 	Value(value interface{}) error
 
+	// ValueBytes of the current key-value tuple, without decoding it using the
+	// Codec. Calling ValueBytes() without calling Next() or when no next item
+	// in the iter will result in `ErrIndexOutOfRange`
+	ValueBytes() ([]byte, error)
+
+	// Err returns the error that stopped the iteration, if any. It should be
+	// checked once Next returns false, to tell the end of the key-value tuples
+	// apart from an error that truncated them.
+	Err() error
+
 	// Close must be called after finishing the iteration to release associated
 	// resources. Close should always success and can be called multiple times
-	// without causing error.
+	// without causing error. Drivers may close the iterator once Next returns
+	// false, after which Seek, First and Last will also return false.
 	Close()
 }
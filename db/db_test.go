@@ -1 +1,700 @@
 package db_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/testutil"
+	"github.com/renproject/phi"
+)
+
+func init() {
+	RegisterMergeFunc("min", func(codec Codec, existing, value []byte) ([]byte, error) {
+		var x, y int64
+		if err := codec.Decode(existing, &x); err != nil {
+			return nil, err
+		}
+		if err := codec.Decode(value, &y); err != nil {
+			return nil, err
+		}
+		if y < x {
+			return value, nil
+		}
+		return existing, nil
+	})
+}
+
+var _ = Describe("db", func() {
+	for i := range testutil.Codecs {
+		for j := range testutil.DbInitalizer {
+			codec := testutil.Codecs[i]
+			initializer := testutil.DbInitalizer[j]
+
+			Context("when iterating over the db", func() {
+				It("should return the keys in lexicographic order", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(name string, keys []string) bool {
+						unique := map[string]struct{}{}
+						for _, key := range keys {
+							unique[key] = struct{}{}
+						}
+						sorted := make([]string, 0, len(unique))
+						for key := range unique {
+							if name+key == "" {
+								continue
+							}
+							sorted = append(sorted, key)
+							Expect(db.Insert(name+key, testutil.RandomTestStruct())).Should(Succeed())
+						}
+						sort.Strings(sorted)
+
+						iterated := make([]string, 0, len(sorted))
+						iter := db.Iterator(name)
+						for iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							iterated = append(iterated, key)
+						}
+						Expect(iter.Err()).NotTo(HaveOccurred())
+						iter.Close()
+						Expect(iterated).Should(Equal(sorted))
+
+						for _, key := range sorted {
+							Expect(db.Delete(name + key)).Should(Succeed())
+						}
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should return the committed and pending keys of a txn in lexicographic order", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(committed, pending []string) bool {
+						unique := map[string]struct{}{}
+						for _, key := range committed {
+							unique[key] = struct{}{}
+							Expect(db.Insert("txn"+key, testutil.RandomTestStruct())).Should(Succeed())
+						}
+
+						txn, err := db.NewTxn()
+						Expect(err).NotTo(HaveOccurred())
+						defer txn.Discard()
+						for _, key := range pending {
+							unique[key] = struct{}{}
+							Expect(txn.Insert("txn"+key, testutil.RandomTestStruct())).Should(Succeed())
+						}
+						sorted := make([]string, 0, len(unique))
+						for key := range unique {
+							sorted = append(sorted, key)
+						}
+						sort.Strings(sorted)
+
+						iterated := make([]string, 0, len(sorted))
+						iter := txn.Iterator("txn")
+						for iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							iterated = append(iterated, key)
+						}
+						iter.Close()
+						Expect(iterated).Should(Equal(sorted))
+
+						for _, key := range sorted {
+							Expect(txn.Delete("txn" + key)).Should(Succeed())
+						}
+						Expect(txn.Commit()).Should(Succeed())
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when iterating over a range of the db", func() {
+				It("should only return the keys in the range", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					for i := 0; i < 100; i++ {
+						Expect(db.Insert(fmt.Sprintf("range%02d", i), testutil.RandomTestStruct())).Should(Succeed())
+					}
+					Expect(db.Insert("rangd", testutil.RandomTestStruct())).Should(Succeed())
+					Expect(db.Insert("rangf", testutil.RandomTestStruct())).Should(Succeed())
+
+					test := func(start, end, limit uint8, reverse bool) bool {
+						opts := IteratorOptions{
+							Start:   fmt.Sprintf("%02d", start%100),
+							End:     fmt.Sprintf("%02d", end%100),
+							Limit:   int(limit % 20),
+							Reverse: reverse,
+						}
+						if start%10 == 0 {
+							opts.Start = ""
+						}
+						if end%10 == 0 {
+							opts.End = ""
+						}
+
+						expected := []string{}
+						for i := 0; i < 100; i++ {
+							key := fmt.Sprintf("%02d", i)
+							if (opts.Start != "" && key < opts.Start) || (opts.End != "" && key >= opts.End) {
+								continue
+							}
+							expected = append(expected, key)
+						}
+						if opts.Reverse {
+							for i, j := 0, len(expected)-1; i < j; i, j = i+1, j-1 {
+								expected[i], expected[j] = expected[j], expected[i]
+							}
+						}
+						if opts.Limit > 0 && len(expected) > opts.Limit {
+							expected = expected[:opts.Limit]
+						}
+
+						iterated := []string{}
+						iter := db.IteratorWithOptions("range", opts)
+						for iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							iterated = append(iterated, key)
+						}
+						iter.Close()
+
+						_, err := iter.Key()
+						Expect(err).Should(Equal(ErrIndexOutOfRange))
+						Expect(iterated).Should(Equal(expected))
+						return true
+					}
+
+					Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when checking whether keys exist", func() {
+				It("should only return true for keys that have a value", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value testutil.TestStruct) bool {
+						if key == "" {
+							_, err := db.Has(key)
+							Expect(err).Should(Equal(ErrEmptyKey))
+							return true
+						}
+
+						ok, err := db.Has(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
+
+						Expect(db.Insert(key, value)).Should(Succeed())
+						ok, err = db.Has(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeTrue())
+
+						Expect(db.Delete(key)).Should(Succeed())
+						ok, err = db.Has(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
+						return true
+					}
+
+					Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when reading stats", func() {
+				It("should count the keys and bytes with the prefix", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(prefix string, values map[string][]byte) bool {
+						defer func() {
+							Expect(db.DeletePrefix("")).Should(Succeed())
+						}()
+
+						expected := Stats{}
+						for key, value := range values {
+							Expect(db.InsertRaw(prefix+key+"\x00", value)).Should(Succeed())
+							Expect(db.InsertRaw("\xff"+prefix+key, value)).Should(Succeed())
+							expected.Keys++
+							expected.KeyBytes += int64(len(prefix + key + "\x00"))
+							expected.ValueBytes += int64(len(value))
+						}
+						if prefix == "" {
+							expected.Keys *= 2
+							expected.KeyBytes *= 2
+							expected.ValueBytes *= 2
+						}
+
+						stats, err := db.Stats(prefix)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(stats.Keys).Should(Equal(expected.Keys))
+						Expect(stats.KeyBytes).Should(Equal(expected.KeyBytes))
+						Expect(stats.ValueBytes).Should(Equal(expected.ValueBytes))
+						Expect(stats.DiskBytes).Should(BeNumerically(">=", 0))
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when deleting by prefix", func() {
+				It("should only delete the keys that begin with the prefix", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(prefix string, keys []string) bool {
+						if prefix == "" {
+							return true
+						}
+						defer func() {
+							Expect(db.DeletePrefix("")).Should(Succeed())
+						}()
+
+						others := map[string]bool{}
+						for _, key := range keys {
+							Expect(db.Insert(prefix+key+"\x00", uint64(1))).Should(Succeed())
+							other := "\xff" + prefix + key
+							Expect(db.Insert(other, uint64(1))).Should(Succeed())
+							others[other] = true
+						}
+
+						Expect(db.DeletePrefix(prefix)).Should(Succeed())
+						size, err := db.Size(prefix)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(size).Should(Equal(0))
+
+						iter := db.Iterator("")
+						defer iter.Close()
+						for iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							Expect(others).Should(HaveKey(key))
+							delete(others, key)
+						}
+						Expect(iter.Err()).NotTo(HaveOccurred())
+						return len(others) == 0
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should delete more keys than fit in one batch", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					for i := 0; i < 2500; i++ {
+						Expect(db.Insert(fmt.Sprintf("prefix%04d", i), uint64(i))).Should(Succeed())
+					}
+					Expect(db.Insert("prefiy", uint64(0))).Should(Succeed())
+
+					Expect(db.DeletePrefix("prefix")).Should(Succeed())
+					size, err := db.Size("")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(1))
+
+					Expect(db.Insert("prefix0000", uint64(1))).Should(Succeed())
+					size, err = db.Size("prefix")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(1))
+				})
+			})
+
+			Context("when merging values", func() {
+				It("should merge values atomically when merged concurrently", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					phi.ParForAll(10, func(i int) {
+						defer GinkgoRecover()
+
+						for j := 0; j < 20; j++ {
+							Expect(db.Merge("sum", MergeAdd, int64(2))).Should(Succeed())
+							Expect(db.Merge("max", MergeMax, int64(i*20+j))).Should(Succeed())
+						}
+					})
+
+					sum, max := int64(0), int64(0)
+					Expect(db.Get("sum", &sum)).Should(Succeed())
+					Expect(sum).Should(Equal(int64(400)))
+					Expect(db.Get("max", &max)).Should(Succeed())
+					Expect(max).Should(Equal(int64(199)))
+				})
+
+				It("should append lists of bytes", func() {
+					if _, err := codec.Encode([][]byte{}); err != nil {
+						Skip("codec cannot encode lists of bytes")
+					}
+					db := initializer(codec)
+					defer db.Close()
+
+					Expect(db.Merge("list", MergeAppend, [][]byte{[]byte("a")})).Should(Succeed())
+					Expect(db.Merge("list", MergeAppend, [][]byte{[]byte("b"), []byte("c")})).Should(Succeed())
+
+					list := [][]byte{}
+					Expect(db.Get("list", &list)).Should(Succeed())
+					Expect(list).Should(Equal([][]byte{[]byte("a"), []byte("b"), []byte("c")}))
+				})
+
+				It("should merge values using registered merge functions", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					Expect(db.Merge("min", "min", int64(3))).Should(Succeed())
+					Expect(db.Merge("min", "min", int64(5))).Should(Succeed())
+					Expect(db.Merge("min", "min", int64(1))).Should(Succeed())
+
+					min := int64(0)
+					Expect(db.Get("min", &min)).Should(Succeed())
+					Expect(min).Should(Equal(int64(1)))
+				})
+
+				It("should return ErrUnknownMergeFunc without writing when the merge function is unknown", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					Expect(db.Merge("key", "unknown", int64(1))).Should(Equal(ErrUnknownMergeFunc))
+					ok, err := db.Has("key")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ok).Should(BeFalse())
+					Expect(db.Merge("", MergeAdd, int64(1))).Should(Equal(ErrEmptyKey))
+				})
+			})
+
+			Context("when writing conditionally", func() {
+				It("should only write when the condition holds", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value, other testutil.TestStruct) bool {
+						if key == "" || reflect.DeepEqual(value, other) {
+							return true
+						}
+
+						ok, err := db.CompareAndSwap(key, value, other)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
+						ok, err = db.InsertIfAbsent(key, value)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeTrue())
+						ok, err = db.InsertIfAbsent(key, other)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
+
+						ok, err = db.CompareAndSwap(key, other, value)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
+						ok, err = db.CompareAndSwap(key, value, other)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeTrue())
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(db.Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, other)).Should(BeTrue())
+
+						ok, err = db.DeleteIfEquals(key, value)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
+						ok, err = db.DeleteIfEquals(key, other)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeTrue())
+						ok, err = db.Has(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should be atomic when written concurrently", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					inserted := make([]bool, 10)
+					phi.ParForAll(inserted, func(i int) {
+						ok, err := db.InsertIfAbsent("leader", uint64(i))
+						Expect(err).NotTo(HaveOccurred())
+						inserted[i] = ok
+					})
+					count := 0
+					for _, ok := range inserted {
+						if ok {
+							count++
+						}
+					}
+					Expect(count).Should(Equal(1))
+
+					Expect(db.Insert("counter", uint64(0))).Should(Succeed())
+					phi.ParForAll(10, func(int) {
+						for i := 0; i < 20; i++ {
+							for {
+								counter := uint64(0)
+								Expect(db.Get("counter", &counter)).Should(Succeed())
+								ok, err := db.CompareAndSwap("counter", counter, counter+1)
+								Expect(err).NotTo(HaveOccurred())
+								if ok {
+									break
+								}
+							}
+						}
+					})
+					counter := uint64(0)
+					Expect(db.Get("counter", &counter)).Should(Succeed())
+					Expect(counter).Should(Equal(uint64(200)))
+				})
+			})
+
+			Context("when reading and writing raw bytes", func() {
+				It("should bypass the codec", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value testutil.TestStruct, data []byte) bool {
+						if key == "" {
+							return true
+						}
+
+						// Raw bytes are returned as they were written.
+						Expect(db.InsertRaw(key, data)).Should(Succeed())
+						raw, err := db.GetRaw(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(len(raw)).Should(Equal(len(data)))
+						if len(data) > 0 {
+							Expect(raw).Should(Equal(data))
+						}
+
+						// Raw bytes encoded by the codec can be decoded.
+						encoded, err := codec.Encode(value)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(db.InsertRaw(key, encoded)).Should(Succeed())
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(db.Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+
+						// Values inserted using the codec are returned encoded.
+						Expect(db.Insert(key, value)).Should(Succeed())
+						raw, err = db.GetRaw(key)
+						Expect(err).NotTo(HaveOccurred())
+						stored = testutil.TestStruct{D: []byte{}}
+						Expect(codec.Decode(raw, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+
+						iter := db.Iterator(key)
+						Expect(iter.Next()).Should(BeTrue())
+						raw, err = iter.ValueBytes()
+						Expect(err).NotTo(HaveOccurred())
+						stored = testutil.TestStruct{D: []byte{}}
+						Expect(codec.Decode(raw, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+						iter.Close()
+
+						Expect(db.Delete(key)).Should(Succeed())
+						_, err = db.GetRaw(key)
+						Expect(err).Should(Equal(ErrKeyNotFound))
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when the context is done", func() {
+				It("should return the error of the context", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value testutil.TestStruct) bool {
+						if key == "" {
+							return true
+						}
+						ctx, cancel := context.WithCancel(context.Background())
+						cancel()
+
+						Expect(db.InsertContext(ctx, key, value)).Should(Equal(context.Canceled))
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(db.Get(key, &stored)).Should(Equal(ErrKeyNotFound))
+
+						Expect(db.Insert(key, value)).Should(Succeed())
+						Expect(db.GetContext(ctx, key, &stored)).Should(Equal(context.Canceled))
+						Expect(db.DeleteContext(ctx, key)).Should(Equal(context.Canceled))
+						_, err := db.SizeContext(ctx, key)
+						Expect(err).Should(Equal(context.Canceled))
+
+						Expect(db.GetContext(context.Background(), key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+						Expect(db.DeleteContext(context.Background(), key)).Should(Succeed())
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should stop iterating and return the error of the context", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					for i := 0; i < 100; i++ {
+						Expect(db.Insert(fmt.Sprintf("ctx%02d", i), testutil.RandomTestStruct())).Should(Succeed())
+					}
+
+					test := func(n uint8, reverse bool) bool {
+						ctx, cancel := context.WithCancel(context.Background())
+						defer cancel()
+
+						iter := db.IteratorContext(ctx, "ctx", IteratorOptions{Reverse: reverse})
+						defer iter.Close()
+						for i := 0; i < int(n%100); i++ {
+							Expect(iter.Next()).Should(BeTrue())
+						}
+						Expect(iter.Err()).NotTo(HaveOccurred())
+
+						cancel()
+						Expect(iter.Next()).Should(BeFalse())
+						Expect(iter.Seek("")).Should(BeFalse())
+						Expect(iter.Err()).Should(Equal(context.Canceled))
+						return true
+					}
+
+					Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when seeking in a range of the db", func() {
+				It("should move to the keys relative to the prefix", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					for i := 0; i < 100; i += 2 {
+						Expect(db.Insert(fmt.Sprintf("seek%02d", i), testutil.RandomTestStruct())).Should(Succeed())
+					}
+					Expect(db.Insert("seej", testutil.RandomTestStruct())).Should(Succeed())
+					Expect(db.Insert("seel", testutil.RandomTestStruct())).Should(Succeed())
+
+					test := func(start, end, limit, target uint8, reverse bool) bool {
+						opts := IteratorOptions{
+							Start:   fmt.Sprintf("%02d", start%100),
+							End:     fmt.Sprintf("%02d", end%100),
+							Limit:   int(limit % 20),
+							Reverse: reverse,
+						}
+						if start%10 == 0 {
+							opts.Start = ""
+						}
+						if end%10 == 0 {
+							opts.End = ""
+						}
+						seek := fmt.Sprintf("%02d", target%100)
+
+						keys := []string{}
+						for i := 0; i < 100; i += 2 {
+							key := fmt.Sprintf("%02d", i)
+							if (opts.Start != "" && key < opts.Start) || (opts.End != "" && key >= opts.End) {
+								continue
+							}
+							keys = append(keys, key)
+						}
+						expected := []string{}
+						for i := range keys {
+							key := keys[i]
+							if opts.Reverse {
+								key = keys[len(keys)-1-i]
+							}
+							if (!opts.Reverse && key >= seek) || (opts.Reverse && key <= seek) {
+								expected = append(expected, key)
+							}
+						}
+						if opts.Limit > 0 && len(expected) > opts.Limit {
+							expected = expected[:opts.Limit]
+						}
+
+						iter := db.IteratorWithOptions("seek", opts)
+						defer iter.Close()
+
+						Expect(iter.First()).Should(Equal(len(keys) > 0))
+						if len(keys) > 0 {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							Expect(key).Should(Equal(keys[0]))
+						}
+						Expect(iter.Last()).Should(Equal(len(keys) > 0))
+						if len(keys) > 0 {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							Expect(key).Should(Equal(keys[len(keys)-1]))
+						}
+
+						iterated := []string{}
+						for ok := iter.Seek(seek); ok; ok = iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							iterated = append(iterated, key)
+						}
+						_, err := iter.Key()
+						Expect(err).Should(Equal(ErrIndexOutOfRange))
+						Expect(iterated).Should(Equal(expected))
+						return true
+					}
+
+					Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+				})
+
+				It("should move to the keys of a txn", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					for i := 0; i < 10; i++ {
+						Expect(db.Insert(fmt.Sprintf("seektxn%d", i), testutil.RandomTestStruct())).Should(Succeed())
+					}
+					txn, err := db.NewTxn()
+					Expect(err).NotTo(HaveOccurred())
+					defer txn.Discard()
+
+					iter := txn.Iterator("seektxn")
+					defer iter.Close()
+					Expect(iter.Last()).Should(BeTrue())
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key).Should(Equal("9"))
+					Expect(iter.Seek("5")).Should(BeTrue())
+					key, err = iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key).Should(Equal("5"))
+					Expect(iter.Next()).Should(BeTrue())
+					key, err = iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key).Should(Equal("6"))
+					Expect(iter.Seek("a")).Should(BeFalse())
+				})
+
+				It("should not move before the first key in reverse", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					for i := 0; i < 10; i++ {
+						Expect(db.Insert(fmt.Sprintf("seek%d", i), testutil.RandomTestStruct())).Should(Succeed())
+					}
+
+					iter := db.IteratorWithOptions("", IteratorOptions{Reverse: true})
+					defer iter.Close()
+					Expect(iter.Seek("")).Should(BeFalse())
+					Expect(iter.Next()).Should(BeFalse())
+					Expect(iter.Err()).NotTo(HaveOccurred())
+				})
+			})
+		}
+	}
+})
@@ -0,0 +1,365 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FilterOptions restrict the key/value pairs returned by an Iterator created
+// using FilterIterator.
+type FilterOptions struct {
+	// Key returns whether the key/value pair with the given key is accepted.
+	// It is called before the value is decoded, so key/value pairs can be
+	// rejected without decoding them. A nil Key accepts every key.
+	Key func(key string) bool
+
+	// Value returns whether the key/value pair is accepted, using the decode
+	// function to decode the value. It is only called for key/value pairs that
+	// are accepted by Key. If it returns an error, then the Iterator stops and
+	// its Err method returns the error. A nil Value accepts every value. Use
+	// ValuePredicate to create a Value from a predicate over a typed value.
+	//
+	// The last value decoded by Value is kept, and is returned by the first
+	// call to the Value method of the Iterator with a pointer of the same
+	// type, so accepted values are only decoded once.
+	Value func(decode func(value interface{}) error) (bool, error)
+
+	// Project returns the value that is returned by the Value method of the
+	// Iterator for an accepted key/value pair, using the decode function to
+	// decode the stored value, so callers can keep only the part of the value
+	// that they need. The projected value is assigned to the pointer given to
+	// Value, so its type must be assignable to the type that the pointer points
+	// to. ValueBytes still returns the stored value. A nil Project returns the
+	// stored value. Use ValueProjection to create a Project from a function
+	// over a typed value.
+	Project func(decode func(value interface{}) error) (interface{}, error)
+
+	// Skip is the number of accepted key/value pairs that are skipped before
+	// the first key/value pair is returned.
+	Skip int
+
+	// Limit is the maximum number of key/value pairs returned by the Iterator.
+	// Once the limit is reached, the Iterator stops without reading any more
+	// key/value pairs. A limit of zero means there is no limit.
+	Limit int
+}
+
+// ValuePredicate returns a Value function for FilterOptions that decodes the
+// value into a V, and accepts the key/value pair if the predicate returns true.
+func ValuePredicate[V any](predicate func(value V) bool) func(decode func(value interface{}) error) (bool, error) {
+	return func(decode func(value interface{}) error) (bool, error) {
+		var value V
+		if err := decode(&value); err != nil {
+			return false, err
+		}
+		return predicate(value), nil
+	}
+}
+
+// ValueProjection returns a Project function for FilterOptions that decodes the
+// value into a V, and projects it into a P.
+func ValueProjection[V, P any](project func(value V) P) func(decode func(value interface{}) error) (interface{}, error) {
+	return func(decode func(value interface{}) error) (interface{}, error) {
+		var value V
+		if err := decode(&value); err != nil {
+			return nil, err
+		}
+		return project(value), nil
+	}
+}
+
+// FilterIterator returns an Iterator over the key/value pairs of the given
+// Iterator that are accepted by the options, after skipping and up to the
+// limit of the options. Closing the Iterator closes the given Iterator.
+//
+// Seek and First move to the first accepted key/value pair at, or after, the
+// position that they move the given Iterator to. Like IteratorOptions, the
+// limit is counted from that key/value pair, and nothing is skipped. Last moves
+// to the accepted key/value pair with the largest key. Iterators cannot step
+// backwards, so if the last key/value pair is rejected, then Last reads the
+// given Iterator again from its first key/value pair, unless it iterates in
+// reverse. To filter from the end of a large range, filter an Iterator created
+// with the Reverse option instead.
+func FilterIterator(iter Iterator, opts FilterOptions) Iterator {
+	return &filteredIterator{
+		iter: iter,
+		opts: opts,
+	}
+}
+
+type filteredIterator struct {
+	iter Iterator
+	opts FilterOptions
+
+	skipped int
+	count   int
+	valid   bool
+	err     error
+
+	// decoded is the pointer to the last value decoded by the Value option for
+	// the current key/value pair, until it is returned by Value.
+	decoded interface{}
+}
+
+func (iter *filteredIterator) Next() bool {
+	if iter.err != nil || (iter.opts.Limit > 0 && iter.count >= iter.opts.Limit) {
+		return iter.stop()
+	}
+	for iter.iter.Next() {
+		ok, err := iter.accept()
+		if err != nil {
+			iter.err = err
+			return iter.stop()
+		}
+		if !ok {
+			continue
+		}
+		if iter.skipped < iter.opts.Skip {
+			iter.skipped++
+			continue
+		}
+		iter.count++
+		iter.valid = true
+		return true
+	}
+	return iter.stop()
+}
+
+func (iter *filteredIterator) Seek(key string) bool {
+	if iter.err != nil || !iter.iter.Seek(key) {
+		return iter.stop()
+	}
+	return iter.moved()
+}
+
+func (iter *filteredIterator) First() bool {
+	if iter.err != nil || !iter.iter.First() {
+		return iter.stop()
+	}
+	return iter.moved()
+}
+
+func (iter *filteredIterator) Last() bool {
+	if iter.err != nil || !iter.iter.Last() {
+		return iter.stop()
+	}
+	iter.skipped = iter.opts.Skip
+	iter.count = 0
+	ok, err := iter.accept()
+	if err != nil {
+		iter.err = err
+		return iter.stop()
+	}
+	if ok {
+		iter.count = 1
+		iter.valid = true
+		return true
+	}
+
+	last, err := iter.iter.Key()
+	if err != nil {
+		iter.err = err
+		return iter.stop()
+	}
+	reverse, err := iter.reverse(last)
+	if err != nil {
+		iter.err = err
+		return iter.stop()
+	}
+	if reverse {
+		// The given Iterator steps towards smaller keys, so it can step
+		// backwards from its last key/value pair.
+		if !iter.iter.Last() {
+			return iter.stop()
+		}
+		return iter.Next()
+	}
+	return iter.seekLastAccepted(last)
+}
+
+// reverse returns whether the given Iterator iterates in reverse, where the
+// given key is its last key. The key right after the first key is sought, which
+// finds the first key in reverse, and the second key otherwise. It leaves the
+// given Iterator at an unspecified key/value pair.
+func (iter *filteredIterator) reverse(last string) (bool, error) {
+	if !iter.iter.First() {
+		return false, iter.iter.Err()
+	}
+	first, err := iter.iter.Key()
+	if err != nil || first == last {
+		return false, err
+	}
+	if !iter.iter.Seek(first + "\x00") {
+		return false, iter.iter.Err()
+	}
+	key, err := iter.iter.Key()
+	return key == first, err
+}
+
+// seekLastAccepted reads the given Iterator from its first key/value pair up to
+// the given last key, without stepping past it, and then moves to the last
+// accepted key/value pair that was read.
+func (iter *filteredIterator) seekLastAccepted(last string) bool {
+	if !iter.iter.First() {
+		return iter.stop()
+	}
+	found, accepted := "", false
+	for {
+		ok, err := iter.accept()
+		if err != nil {
+			iter.err = err
+			return iter.stop()
+		}
+		key, err := iter.iter.Key()
+		if err != nil {
+			iter.err = err
+			return iter.stop()
+		}
+		if ok {
+			found, accepted = key, true
+		}
+		if key == last || !iter.iter.Next() {
+			break
+		}
+	}
+	if !accepted || !iter.iter.Seek(found) {
+		return iter.stop()
+	}
+	// Accept the key/value pair again, so that the value decoded by the Value
+	// option is kept for the current key/value pair.
+	ok, err := iter.accept()
+	if err != nil {
+		iter.err = err
+	}
+	if !ok || err != nil {
+		return iter.stop()
+	}
+	iter.count = 1
+	iter.valid = true
+	return true
+}
+
+func (iter *filteredIterator) Key() (string, error) {
+	if !iter.valid {
+		return "", ErrIndexOutOfRange
+	}
+	return iter.iter.Key()
+}
+
+func (iter *filteredIterator) Value(value interface{}) error {
+	if !iter.valid {
+		return ErrIndexOutOfRange
+	}
+	if iter.opts.Project == nil {
+		return iter.value(value)
+	}
+
+	projected, err := iter.opts.Project(iter.value)
+	if err != nil {
+		return err
+	}
+	dest := reflect.ValueOf(value)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return fmt.Errorf("cannot assign projected value to %T", value)
+	}
+	if projected == nil {
+		dest.Elem().Set(reflect.Zero(dest.Elem().Type()))
+		return nil
+	}
+	src := reflect.ValueOf(projected)
+	if !src.Type().AssignableTo(dest.Elem().Type()) {
+		return fmt.Errorf("cannot assign projected value of type %T to %T", projected, value)
+	}
+	dest.Elem().Set(src)
+	return nil
+}
+
+// value decodes the current value of the given Iterator, unless it has already
+// been decoded by the Value option.
+func (iter *filteredIterator) value(value interface{}) error {
+	if decoded := iter.decoded; decoded != nil && reflect.TypeOf(decoded) == reflect.TypeOf(value) {
+		// The decoded value is only handed over once, so that values returned
+		// by different calls never share memory.
+		dest := reflect.ValueOf(value)
+		if !dest.IsNil() {
+			iter.decoded = nil
+			dest.Elem().Set(reflect.ValueOf(decoded).Elem())
+			return nil
+		}
+	}
+	return iter.iter.Value(value)
+}
+
+func (iter *filteredIterator) ValueBytes() ([]byte, error) {
+	if !iter.valid {
+		return nil, ErrIndexOutOfRange
+	}
+	return iter.iter.ValueBytes()
+}
+
+func (iter *filteredIterator) Err() error {
+	if iter.err != nil {
+		return iter.err
+	}
+	return iter.iter.Err()
+}
+
+func (iter *filteredIterator) Close() {
+	iter.iter.Close()
+}
+
+// moved is called once the given Iterator has been moved by Seek or First. It
+// moves to the first accepted key/value pair, and resets the count towards
+// the limit. Nothing is skipped once the Iterator has been moved.
+func (iter *filteredIterator) moved() bool {
+	iter.skipped = iter.opts.Skip
+	iter.count = 0
+	ok, err := iter.accept()
+	if err != nil {
+		iter.err = err
+		return iter.stop()
+	}
+	if !ok {
+		return iter.Next()
+	}
+	iter.count = 1
+	iter.valid = true
+	return true
+}
+
+// accept returns whether the current key/value pair of the given Iterator is
+// accepted by the options.
+func (iter *filteredIterator) accept() (bool, error) {
+	iter.decoded = nil
+	if iter.opts.Key != nil {
+		key, err := iter.iter.Key()
+		if err != nil {
+			return false, err
+		}
+		if !iter.opts.Key(key) {
+			return false, nil
+		}
+	}
+	if iter.opts.Value != nil {
+		return iter.opts.Value(iter.decode)
+	}
+	return true, nil
+}
+
+// decode the current value of the given Iterator, and keep it so that it does
+// not need to be decoded again by Value.
+func (iter *filteredIterator) decode(value interface{}) error {
+	if err := iter.iter.Value(value); err != nil {
+		return err
+	}
+	if reflect.ValueOf(value).Kind() == reflect.Ptr {
+		iter.decoded = value
+	}
+	return nil
+}
+
+func (iter *filteredIterator) stop() bool {
+	iter.valid = false
+	iter.decoded = nil
+	return false
+}
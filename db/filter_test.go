@@ -0,0 +1,270 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("filtered iterator", func() {
+	for i := range testutil.Codecs {
+		for j := range testutil.DbInitalizer {
+			codec := testutil.Codecs[i]
+			initializer := testutil.DbInitalizer[j]
+
+			Context("when filtering the key/value pairs of a table", func() {
+				It("should only return the accepted key/value pairs after skipping and up to the limit", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTable(db, "filtered")
+					values := make([]uint64, 100)
+					for i := range values {
+						values[i] = uint64(i * 7 % 100)
+						Expect(table.Insert(fmt.Sprintf("%03d", i), values[i])).Should(Succeed())
+					}
+
+					test := func(skip, limit uint8) bool {
+						decoded := 0
+						iter := FilterIterator(table.Iterator(), FilterOptions{
+							Key: func(key string) bool {
+								return key[len(key)-1] != '5'
+							},
+							Value: ValuePredicate(func(value uint64) bool {
+								decoded++
+								return value%2 == 0
+							}),
+							Skip:  int(skip % 50),
+							Limit: int(limit % 50),
+						})
+						defer iter.Close()
+
+						expected := []string{}
+						for i, value := range values {
+							if i%10 != 5 && value%2 == 0 {
+								expected = append(expected, fmt.Sprintf("%03d", i))
+							}
+						}
+						if len(expected) > int(skip%50) {
+							expected = expected[skip%50:]
+						} else {
+							expected = []string{}
+						}
+						if limit%50 > 0 && len(expected) > int(limit%50) {
+							expected = expected[:limit%50]
+						}
+
+						actual := []string{}
+						for iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							var value uint64
+							Expect(iter.Value(&value)).Should(Succeed())
+							Expect(value % 2).Should(BeZero())
+							actual = append(actual, key)
+						}
+						Expect(iter.Err()).NotTo(HaveOccurred())
+						Expect(actual).Should(Equal(expected))
+
+						// Values of rejected keys are never decoded.
+						Expect(decoded).Should(BeNumerically("<=", 90))
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should seek to the first accepted key/value pair", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTable(db, "filtered")
+					for i := uint64(0); i < 20; i++ {
+						Expect(table.Insert(fmt.Sprintf("%02d", i), i)).Should(Succeed())
+					}
+
+					iter := FilterIterator(table.Iterator(), FilterOptions{
+						Value: ValuePredicate(func(value uint64) bool {
+							return value%5 == 0
+						}),
+						Skip:  1,
+						Limit: 2,
+					})
+					defer iter.Close()
+
+					Expect(iter.Seek("06")).Should(BeTrue())
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key).Should(Equal("10"))
+					Expect(iter.Next()).Should(BeTrue())
+					key, err = iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(key).Should(Equal("15"))
+					Expect(iter.Next()).Should(BeFalse())
+					_, err = iter.Key()
+					Expect(err).Should(Equal(ErrIndexOutOfRange))
+				})
+
+				It("should move to the last accepted key/value pair", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTable(db, "filtered")
+					for i := uint64(0); i < 20; i++ {
+						Expect(table.Insert(fmt.Sprintf("%02d", i), i)).Should(Succeed())
+					}
+
+					for _, reverse := range []bool{false, true} {
+						iter := FilterIterator(table.IteratorWithOptions(IteratorOptions{Reverse: reverse}), FilterOptions{
+							Value: ValuePredicate(func(value uint64) bool {
+								return value%7 == 0
+							}),
+							Skip:  1,
+							Limit: 2,
+						})
+
+						Expect(iter.Last()).Should(BeTrue())
+						key, err := iter.Key()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(key).Should(Equal("14"))
+						var value uint64
+						Expect(iter.Value(&value)).Should(Succeed())
+						Expect(value).Should(Equal(uint64(14)))
+
+						// The limit is counted from the last accepted
+						// key/value pair.
+						if reverse {
+							Expect(iter.Next()).Should(BeTrue())
+							key, err = iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							Expect(key).Should(Equal("07"))
+						}
+						Expect(iter.Next()).Should(BeFalse())
+						Expect(iter.Err()).NotTo(HaveOccurred())
+						iter.Close()
+
+						// Nothing is accepted.
+						iter = FilterIterator(table.IteratorWithOptions(IteratorOptions{Reverse: reverse}), FilterOptions{
+							Key: func(key string) bool {
+								return false
+							},
+						})
+						Expect(iter.Last()).Should(BeFalse())
+						Expect(iter.Err()).NotTo(HaveOccurred())
+						iter.Close()
+					}
+				})
+
+				It("should return the projected values", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTable(db, "filtered")
+					for i := uint64(0); i < 10; i++ {
+						Expect(table.Insert(fmt.Sprintf("%v", i), i)).Should(Succeed())
+					}
+
+					counted := &countingIterator{Iterator: table.Iterator()}
+					iter := FilterIterator(counted, FilterOptions{
+						Value: ValuePredicate(func(value uint64) bool {
+							return value%2 == 0
+						}),
+						Project: ValueProjection(func(value uint64) string {
+							return fmt.Sprintf("value %v", value)
+						}),
+					})
+					defer iter.Close()
+
+					values := []string{}
+					for iter.Next() {
+						var value string
+						Expect(iter.Value(&value)).Should(Succeed())
+						values = append(values, value)
+
+						// The stored value can still be read, but not into a
+						// type that the projection cannot be assigned to.
+						data, err := iter.ValueBytes()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(data).NotTo(BeEmpty())
+						var wrong uint64
+						Expect(iter.Value(&wrong)).ShouldNot(Succeed())
+					}
+					Expect(iter.Err()).NotTo(HaveOccurred())
+					Expect(values).Should(Equal([]string{"value 0", "value 2", "value 4", "value 6", "value 8"}))
+				})
+
+				It("should stop with the error of the value predicate", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTable(db, "filtered")
+					for i := uint64(0); i < 10; i++ {
+						Expect(table.Insert(fmt.Sprintf("%v", i), i)).Should(Succeed())
+					}
+
+					expected := errors.New("cannot filter")
+					iter := FilterIterator(table.Iterator(), FilterOptions{
+						Value: func(decode func(value interface{}) error) (bool, error) {
+							return false, expected
+						},
+					})
+					defer iter.Close()
+
+					Expect(iter.Next()).Should(BeFalse())
+					Expect(iter.Err()).Should(Equal(expected))
+				})
+
+				It("should only decode accepted values once", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTable(db, "filtered")
+					for i := uint64(0); i < 10; i++ {
+						Expect(table.Insert(fmt.Sprintf("%v", i), i)).Should(Succeed())
+					}
+
+					counted := &countingIterator{Iterator: table.Iterator()}
+					iter := FilterIterator(counted, FilterOptions{
+						Value: ValuePredicate(func(value uint64) bool {
+							return value%2 == 0
+						}),
+					})
+					defer iter.Close()
+
+					values := []uint64{}
+					for iter.Next() {
+						var value uint64
+						Expect(iter.Value(&value)).Should(Succeed())
+						values = append(values, value)
+
+						// The value is decoded again once it has been
+						// returned.
+						var again uint64
+						Expect(iter.Value(&again)).Should(Succeed())
+						Expect(again).Should(Equal(value))
+					}
+					Expect(iter.Err()).NotTo(HaveOccurred())
+					Expect(values).Should(Equal([]uint64{0, 2, 4, 6, 8}))
+					Expect(counted.decoded).Should(Equal(15))
+				})
+			})
+		}
+	}
+})
+
+// countingIterator counts the number of values decoded by an Iterator.
+type countingIterator struct {
+	Iterator
+	decoded int
+}
+
+func (iter *countingIterator) Value(value interface{}) error {
+	iter.decoded++
+	return iter.Iterator.Value(value)
+}
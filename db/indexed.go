@@ -0,0 +1,418 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/renproject/kv/keys"
+)
+
+var (
+	// ErrUnknownIndex is returned when looking up keys by an index that the
+	// IndexedTable was not created with.
+	ErrUnknownIndex = errors.New("unknown index")
+
+	// ErrUniqueViolation is returned when inserting a value into an
+	// IndexedTable would index another key by the same value in a unique
+	// Index. The error that is returned wraps ErrUniqueViolation, so it must be
+	// compared using errors.Is.
+	ErrUniqueViolation = errors.New("unique constraint violated")
+)
+
+// An IndexFunc returns the values by which a value is indexed. It is called
+// with the value that is inserted into an IndexedTable. Returning no values
+// leaves the key out of the index.
+type IndexFunc func(value interface{}) ([]string, error)
+
+// An Index of an IndexedTable.
+type Index struct {
+	// Name of the Index. It must be unique within the IndexedTable.
+	Name string
+
+	// Values returns the values by which a value is indexed.
+	Values IndexFunc
+
+	// Unique indexes allow at most one key to be indexed by each value.
+	// Inserting a value that would index a second key by the same value fails
+	// with ErrUniqueViolation, and nothing is written.
+	Unique bool
+}
+
+// An IndexedTable is a Table that maintains secondary indexes of its
+// key/value pairs, so that keys can be looked up by values other than the
+// key. Index entries are written in the same Txn as the key/value pair, so they
+// never drift out of sync, and the entries of an overwritten value are removed.
+type IndexedTable interface {
+
+	// Insert writes the key-value into the IndexedTable, and replaces the
+	// index entries of the key.
+	Insert(key string, value interface{}) error
+
+	// Get the value associated with the given key and write it to the value
+	// interface. The value interface must be a pointer. If the key cannot be
+	// found, then ErrKeyNotFound is returned.
+	Get(key string, value interface{}) error
+
+	// Delete the value with the given key, and its index entries, from the
+	// IndexedTable.
+	Delete(key string) error
+
+	// Has returns whether there is a value associated with the given key.
+	Has(key string) (bool, error)
+
+	// Size returns the number of key/value pairs in the IndexedTable.
+	Size() (int, error)
+
+	// Iterator over the key/value pairs in the IndexedTable, in lexicographic
+	// order of their keys.
+	Iterator() Iterator
+
+	// LookupBy returns the keys that are indexed by the given value in the
+	// Index with the given name, in lexicographic order. If there is no such
+	// Index, then ErrUnknownIndex is returned.
+	LookupBy(index, value string) ([]string, error)
+
+	// IndexRange returns the keys that are indexed by values greater than, or
+	// equal to, the start value and less than the end value in the Index with
+	// the given name. Keys are ordered by their index values, and then by the
+	// keys themselves. An empty end value leaves the range unbounded. At most
+	// limit keys are returned, unless the limit is zero. If there is no such
+	// Index, then ErrUnknownIndex is returned.
+	IndexRange(index, start, end string, limit int) ([]string, error)
+}
+
+const (
+	// indexSubTable is the name of the sub-table that stores the index values
+	// of every key. The entries of each Index are stored in the sub-table with
+	// this name, followed by "/" and the name of the Index.
+	indexSubTable = "__index"
+
+	// uniqueSubTablePrefix begins the names of the sub-tables that store the
+	// claims of unique Indexes.
+	uniqueSubTablePrefix = "__unique/"
+)
+
+// isIndexSubTable returns whether the sub-table name is reserved for the index
+// entries of an IndexedTable.
+func isIndexSubTable(name string) bool {
+	return name == indexSubTable ||
+		strings.HasPrefix(name, indexSubTable+"/") ||
+		strings.HasPrefix(name, uniqueSubTablePrefix)
+}
+
+type indexedTable struct {
+	db      DB
+	table   Table
+	indexes map[string]indexTable
+
+	// values maps every key to the index values of its value, so that stale
+	// index entries can be removed without decoding the value.
+	values Table
+}
+
+type indexTable struct {
+	Index
+	entries Table
+
+	// claims maps every value in a unique Index to the key that is indexed by
+	// it. Txns read the claim of a value whether or not it exists, so
+	// concurrent inserts of the same value conflict on every driver. It is nil
+	// if the Index is not unique.
+	claims Table
+}
+
+// NewIndexedTable creates a new IndexedTable that stores its key/value pairs
+// in the given Table, and its index entries in sub-tables of the Table, so
+// dropping the Table drops its indexes. Txns from the given DB are used to
+// write the key/value pairs and their index entries atomically, so the Table
+// must be stored in the DB. Index entries are only maintained for writes made
+// through the IndexedTable. The sub-tables "__index", "__index/<name>" and
+// "__unique/<name>" are reserved for the index entries, so they must not be
+// used for anything else, and they are left out of SubTableNames. It panics if
+// an Index has no name, or no IndexFunc, or if two Indexes have the same name.
+//
+// If the Table expires its key/value pairs, such as a ttl cache, then each of
+// its sub-tables expires on its own, so index entries can outlive the index
+// values of their key. Index entries, and claims of unique values, are checked
+// against the index values of their key, so stale ones are ignored, but a key
+// can leave the indexes shortly before its key/value pair expires.
+func NewIndexedTable(db DB, table Table, indexes ...Index) IndexedTable {
+	t := &indexedTable{
+		db:      db,
+		table:   table,
+		indexes: make(map[string]indexTable, len(indexes)),
+		values:  table.SubTable(indexSubTable),
+	}
+	for _, index := range indexes {
+		if index.Name == "" || index.Values == nil {
+			panic("index must have a name and an index function")
+		}
+		if _, ok := t.indexes[index.Name]; ok {
+			panic(fmt.Sprintf("index %q is already defined", index.Name))
+		}
+		indexTable := indexTable{
+			Index:   index,
+			entries: table.SubTable(indexSubTable + "/" + index.Name),
+		}
+		if index.Unique {
+			indexTable.claims = table.SubTable(uniqueSubTablePrefix + index.Name)
+		}
+		t.indexes[index.Name] = indexTable
+	}
+	return t
+}
+
+func (t *indexedTable) Insert(key string, value interface{}) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	entries := []interface{}{}
+	for name, index := range t.indexes {
+		values, err := index.Values(value)
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			entries = append(entries, name, v)
+		}
+	}
+
+	return t.update(func(view, txn Txn) error {
+		if err := t.deleteEntries(txn, key); err != nil {
+			return err
+		}
+		if err := view.Insert(key, value); err != nil {
+			return err
+		}
+		return t.insertEntries(txn, key, entries)
+	})
+}
+
+func (t *indexedTable) Get(key string, value interface{}) error {
+	return t.table.Get(key, value)
+}
+
+func (t *indexedTable) Delete(key string) error {
+	return t.update(func(view, txn Txn) error {
+		if err := t.deleteEntries(txn, key); err != nil {
+			return err
+		}
+		return view.Delete(key)
+	})
+}
+
+func (t *indexedTable) Has(key string) (bool, error) {
+	return t.table.Has(key)
+}
+
+func (t *indexedTable) Size() (int, error) {
+	return t.table.Size()
+}
+
+func (t *indexedTable) Iterator() Iterator {
+	return t.table.Iterator()
+}
+
+func (t *indexedTable) LookupBy(index, value string) ([]string, error) {
+	start, end, err := keys.Range(value)
+	if err != nil {
+		return nil, err
+	}
+	return t.scan(index, start, end, 0)
+}
+
+func (t *indexedTable) IndexRange(index, start, end string, limit int) ([]string, error) {
+	s, err := keys.Encode(start)
+	if err != nil {
+		return nil, err
+	}
+	e := ""
+	if end != "" {
+		if e, err = keys.Encode(end); err != nil {
+			return nil, err
+		}
+	}
+	return t.scan(index, s, e, limit)
+}
+
+// scan returns the keys of the index entries in the range. Stale index entries
+// are skipped, and do not count towards the limit.
+func (t *indexedTable) scan(name, start, end string, limit int) ([]string, error) {
+	index, ok := t.indexes[name]
+	if !ok {
+		return nil, ErrUnknownIndex
+	}
+
+	iter := index.entries.IteratorWithOptions(IteratorOptions{Start: start, End: end})
+	defer iter.Close()
+
+	keys := []string{}
+	for (limit <= 0 || len(keys) < limit) && iter.Next() {
+		entry, err := iter.Key()
+		if err != nil {
+			return nil, err
+		}
+		value, key, err := decodeIndexEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := indexedBy(t.values, name, value, key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// update runs the function with a view of the Table in a new Txn, and the Txn
+// itself. The key/value pairs of the Table must be written through the view,
+// and the Txn is committed using the view, so that the Table knows about the
+// writes once they are committed: it is registered, and a cached Table evicts
+// the keys that were written. The Txn is retried until it does not conflict.
+func (t *indexedTable) update(f func(view, txn Txn) error) error {
+	for {
+		txn, err := t.db.NewTxn()
+		if err != nil {
+			return err
+		}
+		view := t.table.Txn(txn)
+		if err := f(view, txn); err != nil {
+			view.Discard()
+			return err
+		}
+		if err := view.Commit(); err != ErrConflict {
+			return err
+		}
+	}
+}
+
+// deleteEntries deletes the index entries of the key, in the Txn.
+func (t *indexedTable) deleteEntries(txn Txn, key string) error {
+	values := t.values.Txn(txn)
+	data, err := values.GetRaw(key)
+	if err == ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entries, err := keys.Decode(string(data))
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(entries); i += 2 {
+		index, ok := t.indexes[entries[i].(string)]
+		if !ok {
+			// The Index has been removed since the entry was written.
+			continue
+		}
+		if err := index.entries.Txn(txn).Delete(keys.MustEncode(entries[i+1], key)); err != nil {
+			return err
+		}
+		if index.claims != nil {
+			if err := index.claims.Txn(txn).Delete(keys.MustEncode(entries[i+1])); err != nil {
+				return err
+			}
+		}
+	}
+	return values.Delete(key)
+}
+
+// insertEntries inserts the index entries of the key, in the Txn. The entries
+// alternate between the names of the Indexes and the values in them. The
+// existing entries of the key must already have been deleted in the Txn, so
+// that a claim of a value in a unique Index by another key is a violation.
+func (t *indexedTable) insertEntries(txn Txn, key string, entries []interface{}) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	for i := 0; i < len(entries); i += 2 {
+		index := t.indexes[entries[i].(string)]
+		if index.claims != nil {
+			if err := t.claim(index, txn, key, entries[i+1].(string)); err != nil {
+				return err
+			}
+		}
+		if err := index.entries.Txn(txn).InsertRaw(keys.MustEncode(entries[i+1], key), []byte{}); err != nil {
+			return err
+		}
+	}
+	return t.values.Txn(txn).InsertRaw(key, []byte(keys.MustEncode(entries...)))
+}
+
+// claim the value in the unique Index for the key, in the Txn. A claim by
+// another key is only a violation if that key is still indexed by the value.
+func (t *indexedTable) claim(index indexTable, txn Txn, key, value string) error {
+	claims := index.claims.Txn(txn)
+	data, err := claims.GetRaw(keys.MustEncode(value))
+	if err != nil && err != ErrKeyNotFound {
+		return err
+	}
+	if err == nil && string(data) != key {
+		ok, err := indexedBy(t.values.Txn(txn), index.Name, value, string(data))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// The claim is stale, so it can be taken.
+			return claims.InsertRaw(keys.MustEncode(value), []byte(key))
+		}
+		return fmt.Errorf("%w: index %q already has value %q for key %q", ErrUniqueViolation, index.Name, value, string(data))
+	}
+	return claims.InsertRaw(keys.MustEncode(value), []byte(key))
+}
+
+// indexedBy returns whether the key is indexed by the value in the Index with
+// the given name, according to the index values of the key that are read from
+// the given Table or Txn. Index entries and claims that disagree with the index
+// values of their key are stale, and are ignored. They are left behind when the
+// sub-tables of the Table expire independently of each other, such as when the
+// Table is a ttl cache.
+func indexedBy(values interface {
+	GetRaw(key string) ([]byte, error)
+}, name, value, key string) (bool, error) {
+	data, err := values.GetRaw(key)
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	entries, err := keys.Decode(string(data))
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i+1 < len(entries); i += 2 {
+		if entries[i] == name && entries[i+1] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// decodeIndexEntry returns the index value and the key of an index entry.
+func decodeIndexEntry(entry string) (string, string, error) {
+	elems, err := keys.Decode(entry)
+	if err != nil {
+		return "", "", err
+	}
+	if len(elems) != 2 {
+		return "", "", keys.ErrInvalidKey
+	}
+	value, ok := elems[0].(string)
+	if !ok {
+		return "", "", keys.ErrInvalidKey
+	}
+	key, ok := elems[1].(string)
+	if !ok {
+		return "", "", keys.ErrInvalidKey
+	}
+	return value, key, nil
+}
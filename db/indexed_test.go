@@ -0,0 +1,297 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/keys"
+	"github.com/renproject/kv/testutil"
+	"github.com/renproject/phi"
+)
+
+// indexes of uint64 values by their parity, and by the value itself.
+var testIndexes = []Index{
+	{
+		Name: "parity",
+		Values: func(value interface{}) ([]string, error) {
+			return []string{fmt.Sprintf("%v", value.(uint64)%2)}, nil
+		},
+	},
+	{
+		Name: "value",
+		Values: func(value interface{}) ([]string, error) {
+			return []string{keys.MustEncode(value.(uint64))}, nil
+		},
+	},
+}
+
+// uniqueIndex indexes uint64 values by the value itself, and allows at most one
+// key to have each value.
+var uniqueIndex = Index{
+	Name: "value",
+	Values: func(value interface{}) ([]string, error) {
+		return []string{fmt.Sprintf("%v", value)}, nil
+	},
+	Unique: true,
+}
+
+var _ = Describe("indexed table", func() {
+	for i := range testutil.Codecs {
+		for j := range testutil.DbInitalizer {
+			codec := testutil.Codecs[i]
+			initializer := testutil.DbInitalizer[j]
+
+			Context("when writing to an indexed table", func() {
+				It("should keep the indexes in sync with the key/value pairs", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(ops []uint8) bool {
+						parent := NewTable(db, "indexed")
+						defer func() {
+							Expect(parent.Drop()).Should(Succeed())
+						}()
+						table := NewIndexedTable(db, parent, testIndexes...)
+
+						values := map[string]uint64{}
+						for _, op := range ops {
+							key := fmt.Sprintf("%v", op%8)
+							if op%3 == 0 {
+								Expect(table.Delete(key)).Should(Succeed())
+								delete(values, key)
+								continue
+							}
+							Expect(table.Insert(key, uint64(op))).Should(Succeed())
+							values[key] = uint64(op)
+						}
+
+						expected := map[string][]string{}
+						for key, value := range values {
+							parity := fmt.Sprintf("%v", value%2)
+							expected[parity] = append(expected[parity], key)
+						}
+						for _, parity := range []string{"0", "1"} {
+							keys, err := table.LookupBy("parity", parity)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(keys).Should(ConsistOf(expected[parity]))
+						}
+
+						size, err := table.Size()
+						Expect(err).NotTo(HaveOccurred())
+						return size == len(values)
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should scan a range of an index in order of the index values", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewIndexedTable(db, NewTable(db, "indexed"), testIndexes...)
+					for i := uint64(0); i < 20; i++ {
+						Expect(table.Insert(fmt.Sprintf("%v", 100-i), i*10)).Should(Succeed())
+					}
+
+					found, err := table.IndexRange("value", keys.MustEncode(uint64(45)), keys.MustEncode(uint64(100)), 0)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found).Should(Equal([]string{"95", "94", "93", "92", "91"}))
+
+					found, err = table.IndexRange("value", keys.MustEncode(uint64(150)), "", 2)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found).Should(Equal([]string{"85", "84"}))
+
+					// Overwritten values are no longer in the index.
+					Expect(table.Insert("85", uint64(1000))).Should(Succeed())
+					found, err = table.IndexRange("value", keys.MustEncode(uint64(150)), "", 0)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found).Should(Equal([]string{"84", "83", "82", "81", "85"}))
+				})
+
+				It("should reject values that are already indexed for another key in a unique index", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewIndexedTable(db, NewTable(db, "indexed"), uniqueIndex)
+					Expect(table.Insert("a", uint64(1))).Should(Succeed())
+					Expect(table.Insert("a", uint64(1))).Should(Succeed())
+
+					err := table.Insert("b", uint64(1))
+					Expect(errors.Is(err, ErrUniqueViolation)).Should(BeTrue())
+					ok, err := table.Has("b")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ok).Should(BeFalse())
+
+					// The value can be claimed once it is no longer indexed.
+					Expect(table.Insert("a", uint64(2))).Should(Succeed())
+					Expect(table.Insert("b", uint64(1))).Should(Succeed())
+					Expect(table.Delete("a")).Should(Succeed())
+					Expect(table.Insert("c", uint64(2))).Should(Succeed())
+
+					for value, key := range map[string]string{"1": "b", "2": "c"} {
+						keys, err := table.LookupBy("value", value)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(keys).Should(Equal([]string{key}))
+					}
+				})
+
+				It("should accept exactly one key when the same unique value is inserted concurrently", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewIndexedTable(db, NewTable(db, "indexed"), uniqueIndex)
+					errs := make([]error, 10)
+					phi.ParForAll(errs, func(i int) {
+						errs[i] = table.Insert(fmt.Sprintf("%v", i), uint64(1))
+					})
+
+					accepted := 0
+					for _, err := range errs {
+						if err == nil {
+							accepted++
+							continue
+						}
+						Expect(errors.Is(err, ErrUniqueViolation)).Should(BeTrue())
+					}
+					Expect(accepted).Should(Equal(1))
+					size, err := table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(1))
+				})
+
+				It("should write the key/value pairs through the view that is committed", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					parent := &committedTable{Table: NewTable(db, "indexed")}
+					table := NewIndexedTable(db, parent, testIndexes...)
+					Expect(table.Insert("a", uint64(1))).Should(Succeed())
+					Expect(table.Insert("b", uint64(2))).Should(Succeed())
+					Expect(table.Delete("a")).Should(Succeed())
+					Expect(parent.committed).Should(Equal([]string{"a", "b", "a"}))
+				})
+
+				It("should ignore stale index entries and claims", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					parent := NewTable(db, "indexed")
+					table := NewIndexedTable(db, parent, uniqueIndex)
+					for i := uint64(0); i < 5; i++ {
+						Expect(table.Insert(fmt.Sprintf("%v", i), i)).Should(Succeed())
+					}
+
+					// Remove the index values of some keys, as if they had
+					// expired before their index entries.
+					values := parent.SubTable("__index")
+					Expect(values.Delete("1")).Should(Succeed())
+					Expect(values.Delete("2")).Should(Succeed())
+
+					found, err := table.LookupBy("value", "1")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found).Should(BeEmpty())
+					found, err = table.IndexRange("value", "", "", 2)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found).Should(Equal([]string{"0", "3"}))
+
+					// The stale claim can be taken by another key.
+					Expect(table.Insert("other", uint64(1))).Should(Succeed())
+					found, err = table.LookupBy("value", "1")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found).Should(Equal([]string{"other"}))
+					err = table.Insert("another", uint64(3))
+					Expect(errors.Is(err, ErrUniqueViolation)).Should(BeTrue())
+				})
+
+				It("should return ErrUnknownIndex when looking up an unknown index", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewIndexedTable(db, NewTable(db, "indexed"), testIndexes...)
+					_, err := table.LookupBy("unknown", "0")
+					Expect(err).Should(Equal(ErrUnknownIndex))
+					_, err = table.IndexRange("unknown", "", "", 0)
+					Expect(err).Should(Equal(ErrUnknownIndex))
+				})
+
+				It("should not write anything when an index function fails", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					failing := Index{
+						Name: "failing",
+						Values: func(value interface{}) ([]string, error) {
+							return nil, fmt.Errorf("cannot index %v", value)
+						},
+					}
+					table := NewIndexedTable(db, NewTable(db, "indexed"), failing)
+					Expect(table.Insert("key", uint64(1))).ShouldNot(Succeed())
+					ok, err := table.Has("key")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ok).Should(BeFalse())
+				})
+
+				It("should not return the sub-tables of the indexes as sub-tables of the table", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					users := NewTable(db, "users")
+					parity := Index{
+						Name: "parity",
+						Values: func(value interface{}) ([]string, error) {
+							return []string{fmt.Sprint(value.(uint64) % 2)}, nil
+						},
+						Unique: true,
+					}
+					table := NewIndexedTable(db, users, parity)
+					Expect(table.Insert("key", uint64(1))).Should(Succeed())
+					Expect(users.SubTable("sessions").Insert("key", uint64(1))).Should(Succeed())
+
+					names, err := users.SubTableNames()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(names).Should(Equal([]string{"sessions"}))
+				})
+			})
+		}
+	}
+})
+
+// committedTable records the keys that are written through its Txn views, once
+// the views are committed.
+type committedTable struct {
+	Table
+	committed []string
+}
+
+func (t *committedTable) Txn(txn Txn) Txn {
+	return &committedTxn{Txn: t.Table.Txn(txn), table: t}
+}
+
+type committedTxn struct {
+	Txn
+	table *committedTable
+	keys  []string
+}
+
+func (txn *committedTxn) Insert(key string, value interface{}) error {
+	txn.keys = append(txn.keys, key)
+	return txn.Txn.Insert(key, value)
+}
+
+func (txn *committedTxn) Delete(key string) error {
+	txn.keys = append(txn.keys, key)
+	return txn.Txn.Delete(key)
+}
+
+func (txn *committedTxn) Commit() error {
+	if err := txn.Txn.Commit(); err != nil {
+		return err
+	}
+	txn.table.committed = append(txn.table.committed, txn.keys...)
+	return nil
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnknownMergeFunc is returned when merging with a MergeFunc that has not
+// been registered.
+var ErrUnknownMergeFunc = errors.New("unknown merge function")
+
+// Names of the built-in MergeFuncs.
+const (
+	// MergeAdd adds int64 values.
+	MergeAdd = "add"
+
+	// MergeMax keeps the largest of int64 values.
+	MergeMax = "max"
+
+	// MergeAppend appends lists of byte slices, encoded as [][]byte values. It
+	// can only be used with Codecs that can encode [][]byte values.
+	MergeAppend = "append"
+)
+
+// MergeFunc merges a new value into the existing value of a key, and returns
+// the merged value. All values are encoded using the given Codec. A MergeFunc
+// must be associative, because drivers can merge values in any grouping. It is
+// never called when the key has no value, so it does not need an identity.
+type MergeFunc func(codec Codec, existing, value []byte) ([]byte, error)
+
+var (
+	mergeFuncsMu = new(sync.RWMutex)
+	mergeFuncs   = map[string]MergeFunc{
+		MergeAdd:    mergeAdd,
+		MergeMax:    mergeMax,
+		MergeAppend: mergeAppend,
+	}
+)
+
+// RegisterMergeFunc makes a MergeFunc available to all DBs by the given name.
+// It panics if the MergeFunc is nil, or if a MergeFunc has already been
+// registered with the same name.
+func RegisterMergeFunc(name string, f MergeFunc) {
+	mergeFuncsMu.Lock()
+	defer mergeFuncsMu.Unlock()
+
+	if f == nil {
+		panic("merge function cannot be nil")
+	}
+	if _, ok := mergeFuncs[name]; ok {
+		panic(fmt.Sprintf("merge function %q is already registered", name))
+	}
+	mergeFuncs[name] = f
+}
+
+// MergeValue encodes the value using the Codec, and merges it into the
+// existing data using the MergeFunc registered with the given name. If the
+// existing data is nil, then the key has no value and the encoded value is
+// returned without being merged. Drivers call MergeValue while holding
+// whatever lock, or txn, makes the read and the write of the key atomic.
+func MergeValue(codec Codec, name string, existing []byte, value interface{}) ([]byte, error) {
+	mergeFuncsMu.RLock()
+	f, ok := mergeFuncs[name]
+	mergeFuncsMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownMergeFunc
+	}
+
+	data, err := codec.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return data, nil
+	}
+	return f(codec, existing, data)
+}
+
+func mergeAdd(codec Codec, existing, value []byte) ([]byte, error) {
+	x, y, err := decodeInt64s(codec, existing, value)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Encode(x + y)
+}
+
+func mergeMax(codec Codec, existing, value []byte) ([]byte, error) {
+	x, y, err := decodeInt64s(codec, existing, value)
+	if err != nil {
+		return nil, err
+	}
+	if y > x {
+		return codec.Encode(y)
+	}
+	return codec.Encode(x)
+}
+
+func mergeAppend(codec Codec, existing, value []byte) ([]byte, error) {
+	var xs, ys [][]byte
+	if err := codec.Decode(existing, &xs); err != nil {
+		return nil, err
+	}
+	if err := codec.Decode(value, &ys); err != nil {
+		return nil, err
+	}
+	return codec.Encode(append(xs, ys...))
+}
+
+func decodeInt64s(codec Codec, existing, value []byte) (int64, int64, error) {
+	var x, y int64
+	if err := codec.Decode(existing, &x); err != nil {
+		return 0, 0, err
+	}
+	if err := codec.Decode(value, &y); err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTableNotFound is returned when a Table has not been registered.
+var ErrTableNotFound = errors.New("table not found")
+
+// TableSchemaVersion is the version of the layout of the key/value pairs of a
+// Table. It is recorded when a Table is registered, so that Tables written
+// using an older layout can be found and migrated if the layout changes.
+const TableSchemaVersion = 1
+
+// ReservedPrefix is the prefix of the key-space in which Tables, and their
+// sub-tables, are registered. Table keys begin with the SHA3 hash of the Table
+// name, so they do not collide with the registry, but keys written directly to
+// the DB must not begin with the prefix. Drivers skip the reserved key-space
+// when reading, or deleting, a prefix that is shorter than ReservedPrefix, such
+// as the empty prefix, so the registry is not part of the whole DB.
+const ReservedPrefix = "__kv_"
+
+// registryPrefix is the prefix of the keys at which Tables are registered.
+const registryPrefix = ReservedPrefix + "registry/"
+
+// subTablePrefix is the prefix of the keys at which sub-tables are registered.
+// The key of a sub-table is the name hash of its parent, followed by "_" and
+// its name, so the keys of the sub-tables nested in a table, at any depth,
+// begin with the name hash of the table.
+const subTablePrefix = ReservedPrefix + "subtables/"
+
+// generations holds a counter for each DB that is incremented whenever a Table,
+// or a sub-table, is removed from the registry of the DB, so that Tables which
+// remember being registered in the DB know to register again. It maps each DB
+// to a *uint64 that is accessed atomically.
+var generations sync.Map
+
+// HidesReserved returns whether reads of the given prefix skip the reserved
+// key-space, because the prefix is shorter than ReservedPrefix and every key
+// in the reserved key-space begins with it.
+func HidesReserved(prefix string) bool {
+	return len(prefix) < len(ReservedPrefix) && strings.HasPrefix(ReservedPrefix, prefix)
+}
+
+// TableMetadata is recorded in the registry of a DB when a Table is first
+// used.
+type TableMetadata struct {
+	// Name of the Table.
+	Name string `json:"name"`
+
+	// CreatedAt is the time at which the Table was registered.
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Codec is the name of the Codec of the DB, as returned by its String
+	// method, when the Table was registered.
+	Codec string `json:"codec"`
+
+	// SchemaVersion is the TableSchemaVersion when the Table was registered.
+	SchemaVersion int `json:"schemaVersion"`
+}
+
+// RegisterTable records the TableMetadata of the Table with the given name in
+// the registry of the DB, unless it has already been registered. Tables
+// created using NewTable are registered when they are first written, so
+// RegisterTable only needs to be called by other implementations of the Table
+// interface.
+func RegisterTable(db DB, name string) error {
+	data, err := encodeTableMetadata(db, name)
+	if err != nil {
+		return err
+	}
+	_, err = db.InsertIfAbsent(registryPrefix+name, data)
+	return err
+}
+
+// RegisterTableIn records the TableMetadata of the Table with the given name in
+// the registry of the DB using the given writer, which is usually a Batch or a
+// Txn of the DB, so that the Table is registered along with the other writes.
+// Unlike RegisterTable, an existing registration is overwritten, so it should
+// only be used when the Table is known not to be registered.
+func RegisterTableIn(db DB, w interface {
+	Insert(key string, value interface{}) error
+}, name string) error {
+	data, err := encodeTableMetadata(db, name)
+	if err != nil {
+		return err
+	}
+	return w.Insert(registryPrefix+name, data)
+}
+
+// UnregisterTable removes the Table with the given name from the registry of
+// the DB. It does not delete the key/value pairs in the Table.
+func UnregisterTable(db DB, name string) error {
+	defer atomic.AddUint64(generation(db), 1)
+	return db.Delete(registryPrefix + name)
+}
+
+// SubTableKey returns the key at which the sub-table with the given name is
+// registered in the table with the given name hash.
+func SubTableKey(nameHash, name string) string {
+	return subTablePrefix + nameHash + "_" + name
+}
+
+// UnregisterSubTable removes the sub-table with the given name from the
+// registry of the table with the given name hash. It does not delete the
+// key/value pairs in the sub-table.
+func UnregisterSubTable(db DB, nameHash, name string) error {
+	defer atomic.AddUint64(generation(db), 1)
+	return db.Delete(SubTableKey(nameHash, name))
+}
+
+// UnregisterSubTables removes all sub-tables nested in the table with the
+// given name hash, at any depth, from the registry. It does not delete the
+// key/value pairs in the sub-tables.
+func UnregisterSubTables(db DB, nameHash string) error {
+	defer atomic.AddUint64(generation(db), 1)
+	return db.DeletePrefix(subTablePrefix + nameHash)
+}
+
+// TableInfo returns the TableMetadata of the Table with the given name. If the
+// Table has not been registered, then ErrTableNotFound is returned.
+func TableInfo(db DB, name string) (TableMetadata, error) {
+	var data []byte
+	if err := db.Get(registryPrefix+name, &data); err != nil {
+		if err == ErrKeyNotFound {
+			return TableMetadata{}, ErrTableNotFound
+		}
+		return TableMetadata{}, err
+	}
+	return decodeTableMetadata(data)
+}
+
+// ListTables returns the TableMetadata of all Tables that have been registered
+// in the DB, in lexicographic order of their names.
+func ListTables(db DB) ([]TableMetadata, error) {
+	iter := db.Iterator(registryPrefix)
+	defer iter.Close()
+
+	tables := []TableMetadata{}
+	for iter.Next() {
+		var data []byte
+		if err := iter.Value(&data); err != nil {
+			return nil, err
+		}
+		metadata, err := decodeTableMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, metadata)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// generation returns the counter of the DB that is incremented whenever a
+// Table, or a sub-table, is removed from its registry.
+func generation(db DB) *uint64 {
+	gen, ok := generations.Load(db)
+	if !ok {
+		gen, _ = generations.LoadOrStore(db, new(uint64))
+	}
+	return gen.(*uint64)
+}
+
+// encodeTableMetadata returns the TableMetadata of a new Table with the given
+// name. The metadata is encoded as JSON, and then as a byte slice using the
+// Codec of the DB, because not all Codecs can encode structs.
+func encodeTableMetadata(db DB, name string) ([]byte, error) {
+	return json.Marshal(TableMetadata{
+		Name:          name,
+		CreatedAt:     time.Now().UTC(),
+		Codec:         fmt.Sprintf("%v", db.Codec()),
+		SchemaVersion: TableSchemaVersion,
+	})
+}
+
+func decodeTableMetadata(data []byte) (TableMetadata, error) {
+	metadata := TableMetadata{}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return TableMetadata{}, fmt.Errorf("cannot decode table metadata: %v", err)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,296 @@
+package db_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing/quick"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("registry", func() {
+	for i := range testutil.Codecs {
+		for j := range testutil.DbInitalizer {
+			codec := testutil.Codecs[i]
+			initializer := testutil.DbInitalizer[j]
+
+			Context("when tables are written", func() {
+				It("should list every table that has been written", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(n uint8) bool {
+						names := testutil.RandomNonDupStrings(int(n%10) + 1)
+						for _, name := range names {
+							table := NewTable(db, name)
+							Expect(table.Insert("key", uint64(n))).Should(Succeed())
+							Expect(table.Insert("key", uint64(n))).Should(Succeed())
+						}
+						// Tables that are never written are not registered.
+						Expect(NewTable(db, "unused").Size()).Should(Equal(0))
+
+						tables, err := ListTables(db)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(tables).Should(HaveLen(len(names)))
+
+						sort.Strings(names)
+						for k, name := range names {
+							Expect(tables[k].Name).Should(Equal(name))
+							Expect(tables[k].Codec).Should(Equal(fmt.Sprintf("%v", codec)))
+							Expect(tables[k].SchemaVersion).Should(Equal(TableSchemaVersion))
+							Expect(NewTable(db, name).Drop()).Should(Succeed())
+						}
+
+						tables, err = ListTables(db)
+						Expect(err).NotTo(HaveOccurred())
+						return len(tables) == 0
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should record the time the table was first written", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					_, err := TableInfo(db, "table")
+					Expect(err).Should(Equal(ErrTableNotFound))
+
+					before := time.Now()
+					table := NewTable(db, "table")
+					batch := table.NewBatch()
+					Expect(batch.Insert("key", uint64(1))).Should(Succeed())
+					Expect(batch.Commit()).Should(Succeed())
+					after := time.Now()
+
+					info, err := TableInfo(db, "table")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Name).Should(Equal("table"))
+					Expect(info.CreatedAt).Should(BeTemporally(">=", before.Add(-time.Second)))
+					Expect(info.CreatedAt).Should(BeTemporally("<=", after.Add(time.Second)))
+
+					// Writing to the table again does not change its metadata.
+					Expect(NewTable(db, "table").Increment("counter", 1)).Should(Succeed())
+					again, err := TableInfo(db, "table")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(again.CreatedAt.Equal(info.CreatedAt)).Should(BeTrue())
+
+					// Clearing the table keeps it registered, but dropping it
+					// does not.
+					Expect(table.Clear()).Should(Succeed())
+					_, err = TableInfo(db, "table")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(table.Drop()).Should(Succeed())
+					_, err = TableInfo(db, "table")
+					Expect(err).Should(Equal(ErrTableNotFound))
+				})
+
+				It("should register tables written in a txn after committing", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					txn, err := db.NewTxn()
+					Expect(err).NotTo(HaveOccurred())
+					view := NewTable(db, "txn").Txn(txn)
+					Expect(view.Insert("key", uint64(1))).Should(Succeed())
+					Expect(view.Commit()).Should(Succeed())
+
+					_, err = TableInfo(db, "txn")
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("should register every table written in a shared batch", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					batch := db.NewBatch()
+					first := NewTable(db, "first").Batch(batch)
+					second := NewTable(db, "second").Batch(batch)
+					Expect(first.Insert("key", uint64(1))).Should(Succeed())
+					Expect(second.Insert("key", uint64(2))).Should(Succeed())
+					Expect(batch.Commit()).Should(Succeed())
+
+					tables, err := ListTables(db)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(tables).Should(HaveLen(2))
+					Expect(tables[0].Name).Should(Equal("first"))
+					Expect(tables[1].Name).Should(Equal("second"))
+				})
+
+				It("should register every table written in a shared txn", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					txn, err := db.NewTxn()
+					Expect(err).NotTo(HaveOccurred())
+					first := NewTable(db, "first").Txn(txn)
+					second := NewTable(db, "second").Txn(txn)
+					sub := NewTable(db, "parent").SubTable("child").Txn(txn)
+					Expect(first.Insert("key", uint64(1))).Should(Succeed())
+					Expect(second.Insert("key", uint64(2))).Should(Succeed())
+					Expect(sub.Insert("key", uint64(3))).Should(Succeed())
+					Expect(first.Commit()).Should(Succeed())
+
+					tables, err := ListTables(db)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(tables).Should(HaveLen(3))
+					Expect(tables[0].Name).Should(Equal("first"))
+					Expect(tables[1].Name).Should(Equal("parent"))
+					Expect(tables[2].Name).Should(Equal("second"))
+
+					names, err := NewTable(db, "parent").SubTableNames()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(names).Should(Equal([]string{"child"}))
+				})
+
+				It("should not register tables written in a discarded txn", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					txn, err := db.NewTxn()
+					Expect(err).NotTo(HaveOccurred())
+					view := NewTable(db, "discarded").Txn(txn)
+					Expect(view.Insert("key", uint64(1))).Should(Succeed())
+					view.Discard()
+
+					_, err = TableInfo(db, "discarded")
+					Expect(err).Should(Equal(ErrTableNotFound))
+				})
+
+				It("should not register tables written in a batch that is not committed", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					batch := NewTable(db, "uncommitted").NewBatch()
+					Expect(batch.Insert("key", uint64(1))).Should(Succeed())
+					Expect(batch.Len()).Should(Equal(1))
+
+					_, err := TableInfo(db, "uncommitted")
+					Expect(err).Should(Equal(ErrTableNotFound))
+				})
+
+				It("should register counted tables when they are created", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					_, err := NewCountedTable(db, "counted")
+					Expect(err).NotTo(HaveOccurred())
+					_, err = TableInfo(db, "counted")
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when reading the whole db", func() {
+				It("should not include the registry", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTable(db, "table")
+					sub := table.SubTable("sub")
+					Expect(table.Insert("key", uint64(1))).Should(Succeed())
+					Expect(sub.Insert("key", uint64(2))).Should(Succeed())
+					Expect(table.Delete("key")).Should(Succeed())
+					Expect(sub.Delete("key")).Should(Succeed())
+
+					size, err := db.Size("")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(BeZero())
+					stats, err := db.Stats("")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stats.Keys).Should(BeZero())
+					iter := db.Iterator("")
+					Expect(iter.Next()).Should(BeFalse())
+					iter.Close()
+
+					snapshot, err := db.Snapshot()
+					Expect(err).NotTo(HaveOccurred())
+					size, err = snapshot.Size("")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(BeZero())
+					snapshot.Release()
+
+					// The registration written by a txn is not read either.
+					txn, err := db.NewTxn()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(NewTable(db, "txn").Txn(txn).Insert("key", uint64(3))).Should(Succeed())
+					iter = txn.Iterator("")
+					Expect(iter.Next()).Should(BeTrue())
+					Expect(iter.Next()).Should(BeFalse())
+					iter.Close()
+					txn.Discard()
+
+					// The registry is still there.
+					tables, err := ListTables(db)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(tables).Should(HaveLen(1))
+					names, err := table.SubTableNames()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(names).Should(Equal([]string{"sub"}))
+				})
+
+				It("should skip the reserved key-space in every direction", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					keys := []string{"__ka", "__kv", "__kv`", "a"}
+					for _, key := range append(keys, ReservedPrefix, ReservedPrefix+"a", ReservedPrefix+"b") {
+						Expect(db.Insert(key, uint64(1))).Should(Succeed())
+					}
+					read := func(iter Iterator) []string {
+						defer iter.Close()
+						read := []string{}
+						for iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							read = append(read, key)
+						}
+						Expect(iter.Err()).NotTo(HaveOccurred())
+						return read
+					}
+
+					for _, prefix := range []string{"", "_", "__kv"} {
+						expected := []string{}
+						for _, key := range keys {
+							if strings.HasPrefix(key, prefix) {
+								expected = append(expected, strings.TrimPrefix(key, prefix))
+							}
+						}
+						reversed := make([]string, len(expected))
+						for k := range expected {
+							reversed[len(expected)-1-k] = expected[k]
+						}
+						Expect(read(db.Iterator(prefix))).Should(Equal(expected))
+						Expect(read(db.IteratorWithOptions(prefix, IteratorOptions{Reverse: true}))).Should(Equal(reversed))
+						Expect(read(db.IteratorWithOptions(prefix, IteratorOptions{Limit: 2}))).Should(Equal(expected[:2]))
+						Expect(db.Size(prefix)).Should(Equal(len(expected)))
+					}
+
+					// Seeking into the reserved key-space moves past it.
+					iter := db.Iterator("")
+					Expect(iter.Seek(ReservedPrefix + "a")).Should(BeTrue())
+					Expect(iter.Key()).Should(Equal("__kv`"))
+					iter.Close()
+					iter = db.IteratorWithOptions("", IteratorOptions{Reverse: true})
+					Expect(iter.Seek(ReservedPrefix + "a")).Should(BeTrue())
+					Expect(iter.Key()).Should(Equal("__kv"))
+					Expect(iter.Last()).Should(BeTrue())
+					Expect(iter.Key()).Should(Equal("a"))
+					iter.Close()
+
+					// The reserved key-space can be read with its own prefix,
+					// and is kept when deleting the whole DB.
+					Expect(db.Size(ReservedPrefix)).Should(Equal(3))
+					Expect(db.DeletePrefix("")).Should(Succeed())
+					Expect(db.Size("")).Should(Equal(0))
+					Expect(db.Size(ReservedPrefix)).Should(Equal(3))
+				})
+			})
+		}
+	}
+})
@@ -0,0 +1,120 @@
+package db_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("snapshot", func() {
+	for i := range testutil.Codecs {
+		for j := range testutil.DbInitalizer {
+			codec := testutil.Codecs[i]
+			initializer := testutil.DbInitalizer[j]
+
+			Context("when writing to the db after taking a snapshot", func() {
+				It("should not observe the writes in the snapshot", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(name string, values []testutil.TestStruct, other testutil.TestStruct) bool {
+						allValues := map[string]testutil.TestStruct{}
+						for i, value := range values {
+							key := fmt.Sprintf("%v", i)
+							Expect(db.Insert(name+key, value)).Should(Succeed())
+							allValues[key] = value
+						}
+
+						snapshot, err := db.Snapshot()
+						Expect(err).NotTo(HaveOccurred())
+						defer snapshot.Release()
+
+						// Overwrite, and delete, everything and then add something new.
+						for i := range values {
+							key := fmt.Sprintf("%v%v", name, i)
+							if i%2 == 0 {
+								Expect(db.Insert(key, other)).Should(Succeed())
+							} else {
+								Expect(db.Delete(key)).Should(Succeed())
+							}
+						}
+						Expect(db.Insert(fmt.Sprintf("%v%v", name, len(values)), other)).Should(Succeed())
+
+						size, err := snapshot.Size(name)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(size).Should(Equal(len(values)))
+
+						for key, value := range allValues {
+							stored := testutil.TestStruct{D: []byte{}}
+							Expect(snapshot.Get(name+key, &stored)).Should(Succeed())
+							Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+						}
+
+						iter := snapshot.Iterator(name)
+						for iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							value := testutil.TestStruct{D: []byte{}}
+							Expect(iter.Value(&value)).Should(Succeed())
+
+							stored, ok := allValues[key]
+							Expect(ok).Should(BeTrue())
+							Expect(reflect.DeepEqual(value, stored)).Should(BeTrue())
+							delete(allValues, key)
+						}
+						iter.Close()
+
+						for i := 0; i <= len(values); i++ {
+							Expect(db.Delete(fmt.Sprintf("%v%v", name, i))).Should(Succeed())
+						}
+						return len(allValues) == 0
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when reading a table from a snapshot", func() {
+				It("should only read the key/value pairs in the table", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value, other testutil.TestStruct) bool {
+						first := NewTable(db, "first")
+						second := NewTable(db, "second")
+						Expect(first.Insert(key, value)).Should(Succeed())
+
+						snapshot, err := db.Snapshot()
+						Expect(err).NotTo(HaveOccurred())
+						view := first.Snapshot(snapshot)
+						defer view.Release()
+
+						Expect(first.Insert(key, other)).Should(Succeed())
+						Expect(second.Insert(key, other)).Should(Succeed())
+
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(view.Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+						Expect(second.Snapshot(snapshot).Get(key, &stored)).Should(Equal(ErrKeyNotFound))
+
+						size, err := view.Size("")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(size).Should(Equal(1))
+
+						Expect(first.Delete(key)).Should(Succeed())
+						Expect(second.Delete(key)).Should(Succeed())
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+			})
+		}
+	}
+})
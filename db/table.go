@@ -1,7 +1,11 @@
 package db
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"reflect"
+	"sync/atomic"
 
 	"golang.org/x/crypto/sha3"
 )
@@ -22,29 +26,189 @@ type Table interface {
 	// Delete the value with the given key from the Table.
 	Delete(key string) error
 
+	// Has returns whether there is a value associated with the given key,
+	// without reading or decoding the value.
+	Has(key string) (bool, error)
+
+	// InsertIfAbsent writes the key-value into the Table if, and only if,
+	// there is no value associated with the key. It returns whether the
+	// key-value was written.
+	InsertIfAbsent(key string, value interface{}) (bool, error)
+
+	// DeleteIfEquals deletes the value with the given key from the Table if,
+	// and only if, it is equal to the given value. It returns whether the
+	// value was deleted. Values are compared using EqualValue.
+	DeleteIfEquals(key string, value interface{}) (bool, error)
+
+	// CompareAndSwap writes the new value for the given key if, and only if,
+	// the current value is equal to the old value. It returns whether the new
+	// value was written. Values are compared using EqualValue.
+	CompareAndSwap(key string, old, new interface{}) (bool, error)
+
+	// Update atomically reads, modifies and writes the value associated with
+	// the given key. The value is decoded into ptr, which must be a pointer,
+	// and fn is called with whether the value exists. If the value does not
+	// exist, ptr is left as it was given. If fn returns nil, then ptr is
+	// written back to the Table, otherwise nothing is written and the error is
+	// returned. If the write conflicts with another write, then ptr is reset
+	// and fn is called again, so fn must be safe to call more than once.
+	Update(key string, ptr interface{}, fn func(exists bool) error) error
+
+	// Merge atomically merges the value into the value associated with the
+	// given key, using the MergeFunc registered with the given name. If there
+	// is no value associated with the key, then the value is written as it is.
+	Merge(key, name string, value interface{}) error
+
+	// Increment atomically adds the delta to the int64 value associated with
+	// the given key, using the MergeAdd MergeFunc. If there is no value
+	// associated with the key, then the delta is written as it is.
+	Increment(key string, delta int64) error
+
+	// Clear deletes all of the key/value pairs in the Table. The Table can
+	// still be used after being cleared. The key/value pairs are deleted using
+	// DeletePrefix, so concurrent writes to the DB can fail on some drivers.
+	Clear() error
+
+	// Drop deletes all of the key/value pairs in the Table, its sub-tables, and
+	// anything else that is stored for the Table. The Table must not be used
+	// after being dropped, but a new Table can be created with the same name.
+	// Like Clear, concurrent writes to the DB can fail on some drivers.
+	Drop() error
+
+	// SubTable returns the Table with the given name that is nested in the
+	// namespace of this Table. Sub-tables can be nested to any depth. The
+	// key/value pairs of a sub-table are not part of this Table, so they are not
+	// returned by its Iterator, counted by its Size, or deleted when it is
+	// cleared. They are deleted when this Table is dropped.
+	SubTable(name string) Table
+
+	// SubTableNames returns the names of the sub-tables of the Table that have
+	// been written, in lexicographic order. The sub-tables that store the index
+	// entries of an IndexedTable are left out.
+	SubTableNames() ([]string, error)
+
 	// Size returns the number of key/value pairs in the Table.
 	Size() (int, error)
 
-	// Iterator over the key/value pairs in the Table.
+	// Stats returns statistics about the key/value pairs in the Table. The key
+	// bytes include the prefix that partitions the Table.
+	Stats() (Stats, error)
+
+	// Iterator over the key/value pairs in the Table, in lexicographic order of
+	// their keys.
 	Iterator() Iterator
+
+	// RangeIterator over the key/value pairs in the Table where the key is
+	// greater than, or equal to, the start key and less than the end key. An
+	// empty start, or end, key leaves that side of the range unbounded. At most
+	// limit key/value pairs are returned, unless the limit is zero.
+	RangeIterator(start, end string, limit int) Iterator
+
+	// IteratorWithOptions returns an Iterator over the key/value pairs in the
+	// Table that are in the range of the options.
+	IteratorWithOptions(opts IteratorOptions) Iterator
+
+	// InsertContext is like Insert, but returns the error of the context,
+	// without writing, if the context is done.
+	InsertContext(ctx context.Context, key string, value interface{}) error
+
+	// GetContext is like Get, but returns the error of the context, without
+	// reading, if the context is done.
+	GetContext(ctx context.Context, key string, value interface{}) error
+
+	// DeleteContext is like Delete, but returns the error of the context,
+	// without deleting, if the context is done.
+	DeleteContext(ctx context.Context, key string) error
+
+	// SizeContext is like Size, but stops counting and returns the error of
+	// the context once the context is done.
+	SizeContext(ctx context.Context) (int, error)
+
+	// IteratorContext is like IteratorWithOptions, but the Iterator stops once
+	// the context is done, after which its Err method returns the error of the
+	// context.
+	IteratorContext(ctx context.Context, opts IteratorOptions) Iterator
+
+	// InsertRaw writes the key-value into the Table without encoding the value
+	// using the Codec.
+	InsertRaw(key string, data []byte) error
+
+	// GetRaw returns the value associated with the given key without decoding
+	// it using the Codec. If the key cannot be found, then ErrKeyNotFound is
+	// returned.
+	GetRaw(key string) ([]byte, error)
+
+	// Scan returns one page of key/value pairs in the Table, in lexicographic
+	// order of their keys, and the cursor of the next page. The page starts at
+	// the cursor, and holds at most limit key/value pairs, unless the limit is
+	// zero, in which case it holds the rest of the Table. An empty cursor
+	// starts at the beginning of the Table, and an empty next cursor means
+	// there are no more pages. Cursors are opaque and depend only on the keys,
+	// so they can be reused across drivers and restarts.
+	Scan(cursor string, limit int) ([]Entry, string, error)
+
+	// NewBatch returns an empty Batch that writes key/value pairs into the
+	// Table atomically.
+	NewBatch() Batch
+
+	// Batch returns a view of the given Batch that writes key/value pairs into
+	// the Table. Writes are added to the given Batch, so passing the same Batch
+	// to multiple Tables allows writes to be committed atomically across all of
+	// them.
+	Batch(batch Batch) Batch
+
+	// Txn returns a view of the given Txn that reads and writes key/value pairs
+	// in the Table. Committing, or discarding, the view commits, or discards,
+	// the given Txn. Passing the same Txn to multiple Tables allows reads and
+	// writes across all of them to happen in one transaction.
+	Txn(txn Txn) Txn
+
+	// Snapshot returns a read-only view of the Table in the given Snapshot.
+	// Releasing the view releases the given Snapshot. Passing the same Snapshot
+	// to multiple Tables allows consistent reads across all of them.
+	Snapshot(snapshot Snapshot) Snapshot
 }
 
 type table struct {
 	db       DB
+	name     string
 	nameHash string
+
+	// parent is the table that the table is nested in, or nil if the table
+	// is not a sub-table.
+	parent *table
+
+	// gen is the counter of the DB that is incremented whenever a table is
+	// removed from its registry, and registered is one more than its value
+	// when the table was last known to be in the registry, or zero. The table
+	// is registered again once gen changes, because any table of the DB, and
+	// any other instance of this table, could have been dropped. It can still
+	// be stale if the table is dropped by another process. Both are accessed
+	// atomically.
+	gen        *uint64
+	registered uint64
 }
 
 // NewTable creates a new Table with the given name. If the underlying DB is
-// safe for concurrent use, then the Table is safe for concurrent use.
+// safe for concurrent use, then the Table is safe for concurrent use. The
+// Table is registered in the DB, so that it can be found using ListTables,
+// when it is first written, and again when it is written after being dropped.
+// Drops made by another process are not noticed, so the Table is not
+// registered again after them until it is created again.
 func NewTable(db DB, name string) Table {
 	hash := sha3.Sum256([]byte(name))
 	return &table{
 		db:       db,
+		name:     name,
 		nameHash: string(hash[:]),
+		gen:      generation(db),
 	}
 }
 
 func (t *table) Insert(key string, value interface{}) error {
+	if err := t.register(); err != nil {
+		return err
+	}
 	return t.db.Insert(t.keyWithPrefix(key), value)
 }
 
@@ -56,14 +220,520 @@ func (t *table) Delete(key string) error {
 	return t.db.Delete(t.keyWithPrefix(key))
 }
 
+func (t *table) Has(key string) (bool, error) {
+	return t.db.Has(t.keyWithPrefix(key))
+}
+
+func (t *table) InsertIfAbsent(key string, value interface{}) (bool, error) {
+	if err := t.register(); err != nil {
+		return false, err
+	}
+	return t.db.InsertIfAbsent(t.keyWithPrefix(key), value)
+}
+
+func (t *table) DeleteIfEquals(key string, value interface{}) (bool, error) {
+	return t.db.DeleteIfEquals(t.keyWithPrefix(key), value)
+}
+
+func (t *table) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	if err := t.register(); err != nil {
+		return false, err
+	}
+	return t.db.CompareAndSwap(t.keyWithPrefix(key), old, new)
+}
+
+func (t *table) Update(key string, ptr interface{}, fn func(exists bool) error) error {
+	if err := t.register(); err != nil {
+		return err
+	}
+	return UpdateTable(t.db, t, key, ptr, fn)
+}
+
+func (t *table) Merge(key, name string, value interface{}) error {
+	if err := t.register(); err != nil {
+		return err
+	}
+	return t.db.Merge(t.keyWithPrefix(key), name, value)
+}
+
+func (t *table) Increment(key string, delta int64) error {
+	return t.Merge(key, MergeAdd, delta)
+}
+
+func (t *table) Clear() error {
+	return t.db.DeletePrefix(t.keyWithPrefix(""))
+}
+
+func (t *table) Drop() error {
+	// Keys of the table, and of its sub-tables, begin with the name hash, and
+	// the name hashes of tables with the same parent have the same length, so
+	// the prefix does not match any other table.
+	if err := t.db.DeletePrefix(t.nameHash); err != nil {
+		return err
+	}
+	if err := UnregisterSubTables(t.db, t.nameHash); err != nil {
+		return err
+	}
+	if err := t.unregister(); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&t.registered, 0)
+	return nil
+}
+
+func (t *table) SubTable(name string) Table {
+	hash := sha3.Sum256([]byte(name))
+	return &table{
+		db:       t.db,
+		name:     name,
+		nameHash: t.nameHash + "/" + string(hash[:]),
+		parent:   t,
+		gen:      t.gen,
+	}
+}
+
+func (t *table) SubTableNames() ([]string, error) {
+	return SubTableNames(t.db, SubTableKey(t.nameHash, ""))
+}
+
 func (t *table) Size() (int, error) {
 	return t.db.Size(t.keyWithPrefix(""))
 }
 
+func (t *table) Stats() (Stats, error) {
+	return t.db.Stats(t.keyWithPrefix(""))
+}
+
 func (t *table) Iterator() Iterator {
 	return t.db.Iterator(t.keyWithPrefix(""))
 }
 
+func (t *table) RangeIterator(start, end string, limit int) Iterator {
+	return t.IteratorWithOptions(IteratorOptions{
+		Start: start,
+		End:   end,
+		Limit: limit,
+	})
+}
+
+func (t *table) IteratorWithOptions(opts IteratorOptions) Iterator {
+	return t.db.IteratorWithOptions(t.keyWithPrefix(""), opts)
+}
+
+func (t *table) InsertContext(ctx context.Context, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := t.register(); err != nil {
+		return err
+	}
+	return t.db.InsertContext(ctx, t.keyWithPrefix(key), value)
+}
+
+func (t *table) GetContext(ctx context.Context, key string, value interface{}) error {
+	return t.db.GetContext(ctx, t.keyWithPrefix(key), value)
+}
+
+func (t *table) DeleteContext(ctx context.Context, key string) error {
+	return t.db.DeleteContext(ctx, t.keyWithPrefix(key))
+}
+
+func (t *table) SizeContext(ctx context.Context) (int, error) {
+	return t.db.SizeContext(ctx, t.keyWithPrefix(""))
+}
+
+func (t *table) IteratorContext(ctx context.Context, opts IteratorOptions) Iterator {
+	return t.db.IteratorContext(ctx, t.keyWithPrefix(""), opts)
+}
+
+func (t *table) InsertRaw(key string, data []byte) error {
+	if err := t.register(); err != nil {
+		return err
+	}
+	return t.db.InsertRaw(t.keyWithPrefix(key), data)
+}
+
+func (t *table) GetRaw(key string) ([]byte, error) {
+	return t.db.GetRaw(t.keyWithPrefix(key))
+}
+
+func (t *table) Scan(cursor string, limit int) ([]Entry, string, error) {
+	return ScanTable(t, cursor, limit)
+}
+
+func (t *table) NewBatch() Batch {
+	return t.Batch(t.db.NewBatch())
+}
+
+func (t *table) Batch(batch Batch) Batch {
+	return &tableBatch{
+		batch: batch,
+		table: t,
+	}
+}
+
+func (t *table) Txn(txn Txn) Txn {
+	return &tableTxn{
+		txn:   txn,
+		table: t,
+	}
+}
+
+func (t *table) Snapshot(snapshot Snapshot) Snapshot {
+	return &tableSnapshot{
+		snapshot: snapshot,
+		table:    t,
+	}
+}
+
 func (t *table) keyWithPrefix(key string) string {
 	return fmt.Sprintf("%v_%v", t.nameHash, key)
 }
+
+// register the table in the DB, unless it is already known to be registered.
+// Sub-tables are recorded in their parent, which is registered in turn. It
+// must not be called while a Txn of the DB is open in the same goroutine,
+// because some drivers lock all keys until the Txn is done.
+func (t *table) register() error {
+	gen := atomic.LoadUint64(t.gen)
+	if atomic.LoadUint64(&t.registered) == gen+1 {
+		return nil
+	}
+	if t.parent == nil {
+		if err := RegisterTable(t.db, t.name); err != nil {
+			return err
+		}
+	} else {
+		if err := t.parent.register(); err != nil {
+			return err
+		}
+		if err := t.db.Insert(SubTableKey(t.parent.nameHash, t.name), []byte{}); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&t.registered, gen+1)
+	return nil
+}
+
+// isRegistered returns whether the table is known to be in the registry of the
+// DB, because it has been registered since any table was last dropped.
+func (t *table) isRegistered() bool {
+	return atomic.LoadUint64(&t.registered) == atomic.LoadUint64(t.gen)+1
+}
+
+// writer is implemented by the Batch and the Txn.
+type writer interface {
+	Insert(key string, value interface{}) error
+}
+
+// registerIn writes the registration of the table using the given writer,
+// which is a Batch or a Txn, unless the table is already known to be
+// registered. The registration is only written if has does not find it, so
+// that the time at which a table was registered is never overwritten.
+func (t *table) registerIn(w writer, has func(key string) (bool, error)) error {
+	if t.isRegistered() {
+		return nil
+	}
+	if t.parent != nil {
+		if err := t.parent.registerIn(w, has); err != nil {
+			return err
+		}
+		return w.Insert(SubTableKey(t.parent.nameHash, t.name), []byte{})
+	}
+
+	ok, err := has(registryPrefix + t.name)
+	if ok || err != nil {
+		return err
+	}
+	return RegisterTableIn(t.db, w, t.name)
+}
+
+// unregister the table from the DB, or from its parent if it is a sub-table.
+func (t *table) unregister() error {
+	if t.parent == nil {
+		return UnregisterTable(t.db, t.name)
+	}
+	return UnregisterSubTable(t.db, t.parent.nameHash, t.name)
+}
+
+// An Entry is a key/value pair in a page returned by Scan. The value is not
+// decoded, because only the caller knows its type, so it must be decoded using
+// the Codec of the DB.
+type Entry struct {
+	Key   string
+	Value []byte
+}
+
+// ScanTable implements the Scan method of the Table interface using the
+// IteratorWithOptions method of the given Table. One more key/value pair than
+// the limit is read, so that no cursor is returned after the last page.
+func ScanTable(table Table, cursor string, limit int) ([]Entry, string, error) {
+	start, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	opts := IteratorOptions{Start: string(start)}
+	if limit > 0 {
+		opts.Limit = limit + 1
+	}
+	iter := table.IteratorWithOptions(opts)
+	defer iter.Close()
+
+	entries := []Entry{}
+	for iter.Next() {
+		key, err := iter.Key()
+		if err != nil {
+			return nil, "", err
+		}
+		if limit > 0 && len(entries) == limit {
+			// The next page starts at the first key after this page.
+			return entries, base64.RawURLEncoding.EncodeToString([]byte(key)), nil
+		}
+		value, err := iter.ValueBytes()
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, Entry{Key: key, Value: value})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, "", err
+	}
+	return entries, "", nil
+}
+
+// SubTableNames implements the SubTableNames method of the Table interface by
+// returning the keys in the DB that begin with the given prefix, without the
+// prefix. Tables record the name of each sub-table that has been written as a
+// key beginning with the prefix. Names reserved for the index entries of an
+// IndexedTable are left out.
+func SubTableNames(db DB, prefix string) ([]string, error) {
+	iter := db.Iterator(prefix)
+	defer iter.Close()
+
+	names := []string{}
+	for iter.Next() {
+		name, err := iter.Key()
+		if err != nil {
+			return nil, err
+		}
+		if isIndexSubTable(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// UpdateTable implements the Update method of the Table interface using Txns
+// from the given DB, viewed through the Txn method of the given Table. The Txn
+// is retried until it does not conflict. Before each retry, ptr is restored to
+// a shallow copy of the value it was given, so fn sees the same starting
+// value whenever the key does not exist.
+func UpdateTable(db DB, table Table, key string, ptr interface{}, fn func(exists bool) error) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	value := reflect.ValueOf(ptr)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return fmt.Errorf("expected non-nil pointer, got %T", ptr)
+	}
+	initial := reflect.New(value.Elem().Type()).Elem()
+	initial.Set(value.Elem())
+
+	attempt := 0
+	return runTxn(db, func(dbTxn Txn) error {
+		if attempt++; attempt > 1 {
+			value.Elem().Set(initial)
+		}
+		txn := table.Txn(dbTxn)
+
+		exists := true
+		if err := txn.Get(key, ptr); err != nil {
+			if err != ErrKeyNotFound {
+				return err
+			}
+			exists = false
+		}
+		if err := fn(exists); err != nil {
+			return err
+		}
+		return txn.Insert(key, ptr)
+	})
+}
+
+// runTxn runs the function in a new Txn from the given DB, and commits the Txn
+// if the function succeeds. The Txn is retried until it does not conflict, so
+// the function must be safe to call more than once.
+func runTxn(db DB, f func(txn Txn) error) error {
+	for {
+		txn, err := db.NewTxn()
+		if err != nil {
+			return err
+		}
+		if err := f(txn); err != nil {
+			txn.Discard()
+			return err
+		}
+		if err := txn.Commit(); err != ErrConflict {
+			return err
+		}
+	}
+}
+
+// tableBatch is a view of a Batch that prefixes all keys with the name hash of
+// a table. The registration of the table is written in the Batch along with
+// the first write of the view, so the table is registered when the Batch is
+// committed, no matter which view commits it, and a Batch that is never
+// committed does not register the table.
+type tableBatch struct {
+	batch   Batch
+	table   *table
+	written bool
+
+	// gen is the value of the counter of the table when the registration was
+	// written.
+	gen uint64
+}
+
+func (b *tableBatch) Insert(key string, value interface{}) error {
+	if err := b.register(); err != nil {
+		return err
+	}
+	return b.batch.Insert(b.table.keyWithPrefix(key), value)
+}
+
+func (b *tableBatch) Delete(key string) error {
+	return b.batch.Delete(b.table.keyWithPrefix(key))
+}
+
+func (b *tableBatch) Len() int {
+	return b.batch.Len()
+}
+
+func (b *tableBatch) Commit() error {
+	if err := b.batch.Commit(); err != nil {
+		return err
+	}
+	if b.written {
+		atomic.StoreUint64(&b.table.registered, b.gen+1)
+	}
+	return nil
+}
+
+// register writes the registration of the table in the Batch, once. A Batch
+// cannot be read, so whether the table is already registered is read from the
+// DB.
+func (b *tableBatch) register() error {
+	if b.written {
+		return nil
+	}
+	b.gen = atomic.LoadUint64(b.table.gen)
+	if err := b.table.registerIn(b.batch, b.table.db.Has); err != nil {
+		return err
+	}
+	b.written = true
+	return nil
+}
+
+// tableTxn is a view of a Txn that prefixes all keys with the name hash of a
+// table. The registration of the table is written in the Txn along with the
+// first write of the view, so the table is registered when the Txn is
+// committed, no matter which view commits it.
+type tableTxn struct {
+	txn     Txn
+	table   *table
+	written bool
+
+	// gen is the value of the counter of the table when the registration was
+	// written.
+	gen uint64
+}
+
+func (txn *tableTxn) Get(key string, value interface{}) error {
+	return txn.txn.Get(txn.table.keyWithPrefix(key), value)
+}
+
+func (txn *tableTxn) Insert(key string, value interface{}) error {
+	if err := txn.register(); err != nil {
+		return err
+	}
+	return txn.txn.Insert(txn.table.keyWithPrefix(key), value)
+}
+
+func (txn *tableTxn) Delete(key string) error {
+	return txn.txn.Delete(txn.table.keyWithPrefix(key))
+}
+
+func (txn *tableTxn) Has(key string) (bool, error) {
+	return txn.txn.Has(txn.table.keyWithPrefix(key))
+}
+
+func (txn *tableTxn) InsertRaw(key string, data []byte) error {
+	if err := txn.register(); err != nil {
+		return err
+	}
+	return txn.txn.InsertRaw(txn.table.keyWithPrefix(key), data)
+}
+
+func (txn *tableTxn) GetRaw(key string) ([]byte, error) {
+	return txn.txn.GetRaw(txn.table.keyWithPrefix(key))
+}
+
+func (txn *tableTxn) Iterator(prefix string) Iterator {
+	return txn.txn.Iterator(txn.table.keyWithPrefix(prefix))
+}
+
+func (txn *tableTxn) Commit() error {
+	if err := txn.txn.Commit(); err != nil {
+		return err
+	}
+	if txn.written {
+		atomic.StoreUint64(&txn.table.registered, txn.gen+1)
+	}
+	return nil
+}
+
+func (txn *tableTxn) Discard() {
+	txn.txn.Discard()
+}
+
+// register writes the registration of the table in the Txn, once. It is read
+// and written in the Txn, instead of the DB, because some drivers lock all keys
+// until the Txn is done.
+func (txn *tableTxn) register() error {
+	if txn.written {
+		return nil
+	}
+	txn.gen = atomic.LoadUint64(txn.table.gen)
+	if err := txn.table.registerIn(txn.txn, txn.txn.Has); err != nil {
+		return err
+	}
+	txn.written = true
+	return nil
+}
+
+// tableSnapshot is a view of a Snapshot that prefixes all keys with the name
+// hash of a table.
+type tableSnapshot struct {
+	snapshot Snapshot
+	table    *table
+}
+
+func (snapshot *tableSnapshot) Get(key string, value interface{}) error {
+	return snapshot.snapshot.Get(snapshot.table.keyWithPrefix(key), value)
+}
+
+func (snapshot *tableSnapshot) Size(prefix string) (int, error) {
+	return snapshot.snapshot.Size(snapshot.table.keyWithPrefix(prefix))
+}
+
+func (snapshot *tableSnapshot) Iterator(prefix string) Iterator {
+	return snapshot.snapshot.Iterator(snapshot.table.keyWithPrefix(prefix))
+}
+
+func (snapshot *tableSnapshot) Release() {
+	snapshot.snapshot.Release()
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"reflect"
+	"sort"
 	"testing/quick"
 
 	. "github.com/onsi/ginkgo"
@@ -153,6 +154,435 @@ var _ = Describe("table", func() {
 
 				Expect(quick.Check(iteration, nil)).NotTo(HaveOccurred())
 			})
+
+			It("should only iterate over the range of keys in the Table", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				blocks := NewTable(db, "blocks")
+				other := NewTable(db, "other")
+				for i := 0; i < 50; i++ {
+					Expect(blocks.Insert(fmt.Sprintf("%04d", i), testutil.RandomTestStruct())).Should(Succeed())
+					Expect(other.Insert(fmt.Sprintf("%04d", i), testutil.RandomTestStruct())).Should(Succeed())
+				}
+
+				test := func(start, end, limit uint8) bool {
+					start, end, limit = start%60, end%60, limit%10
+					expected := []string{}
+					for i := int(start); i < int(end) && i < 50; i++ {
+						if limit > 0 && len(expected) >= int(limit) {
+							break
+						}
+						expected = append(expected, fmt.Sprintf("%04d", i))
+					}
+
+					iterated := []string{}
+					iter := blocks.RangeIterator(fmt.Sprintf("%04d", start), fmt.Sprintf("%04d", end), int(limit))
+					defer iter.Close()
+					for iter.Next() {
+						key, err := iter.Key()
+						Expect(err).NotTo(HaveOccurred())
+						iterated = append(iterated, key)
+					}
+					Expect(iterated).Should(Equal(expected))
+					return true
+				}
+
+				Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			})
+
+			It("should iterate over the latest keys in the Table in reverse order", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				blocks := NewTable(db, "blocks")
+				other := NewTable(db, "other")
+				for i := 0; i < 50; i++ {
+					Expect(blocks.Insert(fmt.Sprintf("%04d", i), testutil.RandomTestStruct())).Should(Succeed())
+					Expect(other.Insert(fmt.Sprintf("%04d", i), testutil.RandomTestStruct())).Should(Succeed())
+				}
+
+				test := func(limit uint8) bool {
+					limit = limit % 60
+					expected := []string{}
+					for i := 49; i >= 0; i-- {
+						if limit > 0 && len(expected) >= int(limit) {
+							break
+						}
+						expected = append(expected, fmt.Sprintf("%04d", i))
+					}
+
+					iterated := []string{}
+					iter := blocks.IteratorWithOptions(IteratorOptions{Limit: int(limit), Reverse: true})
+					defer iter.Close()
+					for iter.Next() {
+						key, err := iter.Key()
+						Expect(err).NotTo(HaveOccurred())
+						iterated = append(iterated, key)
+					}
+					Expect(iterated).Should(Equal(expected))
+					return true
+				}
+
+				Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			})
+
+			It("should seek to keys in the Table without leaving the Table", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				blocks := NewTable(db, "blocks")
+				other := NewTable(db, "other")
+				for i := 0; i < 50; i++ {
+					Expect(blocks.Insert(fmt.Sprintf("%04d", i), testutil.RandomTestStruct())).Should(Succeed())
+					Expect(other.Insert(fmt.Sprintf("%04d", i), testutil.RandomTestStruct())).Should(Succeed())
+				}
+
+				test := func(target uint8, reverse bool) bool {
+					seek := fmt.Sprintf("%04d", target%60)
+					expected := []string{}
+					for i := 0; i < 50; i++ {
+						key := fmt.Sprintf("%04d", i)
+						if reverse {
+							key = fmt.Sprintf("%04d", 49-i)
+						}
+						if (!reverse && key >= seek) || (reverse && key <= seek) {
+							expected = append(expected, key)
+						}
+					}
+
+					iterated := []string{}
+					iter := blocks.IteratorWithOptions(IteratorOptions{Reverse: reverse})
+					defer iter.Close()
+					for ok := iter.Seek(seek); ok; ok = iter.Next() {
+						key, err := iter.Key()
+						Expect(err).NotTo(HaveOccurred())
+						iterated = append(iterated, key)
+					}
+					Expect(iterated).Should(Equal(expected))
+					return true
+				}
+
+				Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			})
+
+			It("should scan every key in the Table exactly once across pages", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				test := func(name string, keys []string, limit uint8) bool {
+					table := NewTable(db, name)
+					unique := map[string]testutil.TestStruct{}
+					for _, key := range keys {
+						if key == "" {
+							continue
+						}
+						unique[key] = testutil.RandomTestStruct()
+						Expect(table.Insert(key, unique[key])).Should(Succeed())
+					}
+					expected := make([]string, 0, len(unique))
+					for key := range unique {
+						expected = append(expected, key)
+					}
+					sort.Strings(expected)
+
+					scanned := []string{}
+					cursor := ""
+					for {
+						entries, next, err := table.Scan(cursor, int(limit%5))
+						Expect(err).NotTo(HaveOccurred())
+						for _, entry := range entries {
+							value := testutil.TestStruct{D: []byte{}}
+							Expect(codec.Decode(entry.Value, &value)).Should(Succeed())
+							Expect(reflect.DeepEqual(value, unique[entry.Key])).Should(BeTrue())
+							scanned = append(scanned, entry.Key)
+						}
+						if limit%5 > 0 {
+							Expect(len(entries)).Should(BeNumerically("<=", limit%5))
+						}
+						if next == "" {
+							break
+						}
+						cursor = next
+					}
+					Expect(scanned).Should(Equal(expected))
+
+					for _, key := range expected {
+						Expect(table.Delete(key)).Should(Succeed())
+					}
+					return true
+				}
+
+				Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+			})
+
+			It("should not return a cursor when a page ends at the last key", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				table := NewTable(db, "table")
+				for i := 0; i < 4; i++ {
+					Expect(table.Insert(fmt.Sprintf("%v", i), testutil.RandomTestStruct())).Should(Succeed())
+				}
+
+				entries, next, err := table.Scan("", 4)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(next).Should(BeEmpty())
+				Expect(entries).Should(HaveLen(4))
+			})
+
+			It("should update values atomically when updated concurrently", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				table := NewTable(db, "table")
+				phi.ParForAll(10, func(int) {
+					defer GinkgoRecover()
+
+					for i := 0; i < 20; i++ {
+						counter := uint64(0)
+						Expect(table.Update("counter", &counter, func(exists bool) error {
+							Expect(exists).Should(Equal(counter > 0))
+							counter++
+							return nil
+						})).Should(Succeed())
+					}
+				})
+
+				counter := uint64(0)
+				Expect(table.Get("counter", &counter)).Should(Succeed())
+				Expect(counter).Should(Equal(uint64(200)))
+			})
+
+			It("should not write the value when the update returns an error", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				table := NewTable(db, "table")
+				errUpdate := errors.New("update failed")
+				counter := uint64(0)
+				Expect(table.Update("counter", &counter, func(exists bool) error {
+					Expect(exists).Should(BeFalse())
+					counter++
+					return errUpdate
+				})).Should(Equal(errUpdate))
+
+				ok, err := table.Has("counter")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).Should(BeFalse())
+				Expect(table.Update("", &counter, func(bool) error { return nil })).Should(Equal(ErrEmptyKey))
+			})
+
+			It("should increment counters without affecting other tables", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				tables := []Table{NewTable(db, "a"), NewTable(db, "b")}
+				phi.ParForAll(10, func(i int) {
+					defer GinkgoRecover()
+
+					for j := 0; j < 10; j++ {
+						Expect(tables[i%2].Increment("counter", int64(i%2+1))).Should(Succeed())
+					}
+				})
+
+				for i, table := range tables {
+					counter := int64(0)
+					Expect(table.Get("counter", &counter)).Should(Succeed())
+					Expect(counter).Should(Equal(int64(50 * (i + 1))))
+				}
+			})
+
+			It("should only read the stats of the keys in the Table", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				tables := []Table{NewTable(db, "a"), NewTable(db, "b")}
+				for i := 0; i < 10; i++ {
+					Expect(tables[0].InsertRaw(fmt.Sprintf("%v", i), []byte{1, 2, 3})).Should(Succeed())
+				}
+				Expect(tables[1].InsertRaw("key", []byte{1})).Should(Succeed())
+
+				stats, err := tables[0].Stats()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stats.Keys).Should(Equal(10))
+				Expect(stats.ValueBytes).Should(Equal(int64(30)))
+				stats, err = tables[1].Stats()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stats.Keys).Should(Equal(1))
+				Expect(stats.ValueBytes).Should(Equal(int64(1)))
+			})
+
+			It("should clear and drop tables without affecting other tables", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				tables := []Table{NewTable(db, "a"), NewTable(db, "b"), NewTable(db, "c")}
+				for _, table := range tables {
+					for i := 0; i < 10; i++ {
+						Expect(table.Insert(fmt.Sprintf("%v", i), uint64(i))).Should(Succeed())
+					}
+				}
+
+				Expect(tables[0].Clear()).Should(Succeed())
+				Expect(tables[1].Drop()).Should(Succeed())
+				for i, table := range tables {
+					size, err := table.Size()
+					Expect(err).NotTo(HaveOccurred())
+					if i == 2 {
+						Expect(size).Should(Equal(10))
+					} else {
+						Expect(size).Should(Equal(0))
+					}
+				}
+
+				// Cleared tables can still be used.
+				Expect(tables[0].Insert("0", uint64(0))).Should(Succeed())
+				size, err := tables[0].Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(1))
+			})
+
+			It("should scope the keys of sub-tables to the sub-table", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				test := func(keys []string) bool {
+					accounts := NewTable(db, "accounts")
+					defer func() {
+						Expect(accounts.Drop()).Should(Succeed())
+					}()
+
+					// Names that are prefixes of each other, or that contain
+					// the separator, do not share keys.
+					names := []string{"1", "1_txs", "11"}
+					for _, key := range keys {
+						if key == "" {
+							continue
+						}
+						Expect(accounts.Insert(key, uint64(0))).Should(Succeed())
+						for _, name := range names {
+							Expect(accounts.SubTable(name).SubTable("txs").Insert(key, uint64(1))).Should(Succeed())
+						}
+					}
+					expected, err := accounts.Size()
+					Expect(err).NotTo(HaveOccurred())
+
+					for _, name := range names {
+						account := accounts.SubTable(name)
+						size, err := account.Size()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(size).Should(Equal(0))
+
+						txs := account.SubTable("txs")
+						size, err = txs.Size()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(size).Should(Equal(expected))
+
+						iter := txs.Iterator()
+						for iter.Next() {
+							var value uint64
+							Expect(iter.Value(&value)).Should(Succeed())
+							Expect(value).Should(Equal(uint64(1)))
+						}
+						Expect(iter.Err()).NotTo(HaveOccurred())
+						iter.Close()
+					}
+
+					if expected == 0 {
+						return true
+					}
+					children, err := accounts.SubTableNames()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(children).Should(Equal([]string{"1", "11", "1_txs"}))
+					grandchildren, err := accounts.SubTable("1").SubTableNames()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(grandchildren).Should(Equal([]string{"txs"}))
+
+					// Clearing the parent keeps its sub-tables.
+					Expect(accounts.Clear()).Should(Succeed())
+					size, err := accounts.SubTable("1").SubTable("txs").Size()
+					Expect(err).NotTo(HaveOccurred())
+					return size == expected
+				}
+
+				Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+			})
+
+			It("should drop sub-tables without affecting other tables", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				parent := NewTable(db, "parent")
+				other := NewTable(db, "other")
+				for i := 0; i < 10; i++ {
+					key := fmt.Sprintf("%v", i)
+					Expect(parent.Insert(key, uint64(i))).Should(Succeed())
+					Expect(parent.SubTable("a").Insert(key, uint64(i))).Should(Succeed())
+					Expect(parent.SubTable("b").Insert(key, uint64(i))).Should(Succeed())
+					Expect(other.Insert(key, uint64(i))).Should(Succeed())
+				}
+
+				Expect(parent.SubTable("a").Drop()).Should(Succeed())
+				names, err := parent.SubTableNames()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(names).Should(Equal([]string{"b"}))
+				size, err := parent.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(10))
+
+				Expect(parent.Drop()).Should(Succeed())
+				size, err = parent.SubTable("b").Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+				names, err = parent.SubTableNames()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(names).Should(BeEmpty())
+				size, err = other.Size()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(10))
+
+				// Only the other table is left.
+				size, err = db.Size("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(10))
+			})
+
+			It("should register tables again when they are written after being dropped", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				parent := NewTable(db, "parent")
+				sub := parent.SubTable("sub")
+				Expect(sub.Insert("key", uint64(1))).Should(Succeed())
+				Expect(parent.Drop()).Should(Succeed())
+				Expect(sub.Insert("key", uint64(2))).Should(Succeed())
+
+				tables, err := ListTables(db)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tables).Should(HaveLen(1))
+				Expect(tables[0].Name).Should(Equal("parent"))
+				names, err := parent.SubTableNames()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(names).Should(Equal([]string{"sub"}))
+
+				// Tables are also registered again when another instance of the
+				// table is dropped.
+				Expect(NewTable(db, "parent").Drop()).Should(Succeed())
+				Expect(parent.Insert("key", uint64(3))).Should(Succeed())
+				tables, err = ListTables(db)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tables).Should(HaveLen(1))
+			})
+
+			It("should return ErrInvalidCursor when scanning from an invalid cursor", func() {
+				db := initializer(codec)
+				defer db.Close()
+
+				table := NewTable(db, "table")
+				_, _, err := table.Scan("not a cursor!", 10)
+				Expect(err).Should(Equal(ErrInvalidCursor))
+			})
 		}
 	}
 })
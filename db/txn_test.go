@@ -0,0 +1,248 @@
+package db_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/testutil"
+	"github.com/renproject/phi"
+)
+
+var _ = Describe("txn", func() {
+	for i := range testutil.Codecs {
+		for j := range testutil.DbInitalizer {
+			codec := testutil.Codecs[i]
+			initializer := testutil.DbInitalizer[j]
+
+			Context("when reading and writing in a txn", func() {
+				It("should only be visible to others after committing", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value testutil.TestStruct) bool {
+						if key == "" {
+							return true
+						}
+
+						txn, err := db.NewTxn()
+						Expect(err).NotTo(HaveOccurred())
+						defer txn.Discard()
+
+						// The txn should observe its own writes.
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(txn.Get(key, &stored)).Should(Equal(ErrKeyNotFound))
+						Expect(txn.Insert(key, value)).Should(Succeed())
+						Expect(txn.Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+						Expect(db.Get(key, &stored)).Should(Equal(ErrKeyNotFound))
+
+						Expect(txn.Commit()).Should(Succeed())
+						Expect(txn.Commit()).Should(Equal(ErrTxnDone))
+
+						stored = testutil.TestStruct{D: []byte{}}
+						Expect(db.Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+						Expect(db.Delete(key)).Should(Succeed())
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should not write anything when discarded", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value testutil.TestStruct) bool {
+						if key == "" {
+							return true
+						}
+
+						txn, err := db.NewTxn()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(txn.Insert(key, value)).Should(Succeed())
+						txn.Discard()
+						Expect(txn.Insert(key, value)).Should(Equal(ErrTxnDone))
+
+						iter := txn.Iterator("")
+						Expect(iter.Next()).Should(BeFalse())
+						Expect(iter.Err()).Should(Equal(ErrTxnDone))
+						iter.Close()
+
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(db.Get(key, &stored)).Should(Equal(ErrKeyNotFound))
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should check and read raw bytes in the txn", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value testutil.TestStruct) bool {
+						if key == "" {
+							return true
+						}
+						data, err := codec.Encode(value)
+						Expect(err).NotTo(HaveOccurred())
+
+						txn, err := db.NewTxn()
+						Expect(err).NotTo(HaveOccurred())
+						defer txn.Discard()
+
+						ok, err := txn.Has(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
+						_, err = txn.GetRaw(key)
+						Expect(err).Should(Equal(ErrKeyNotFound))
+
+						Expect(txn.InsertRaw(key, data)).Should(Succeed())
+						ok, err = txn.Has(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeTrue())
+						raw, err := txn.GetRaw(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(raw).Should(Equal(data))
+						Expect(txn.Commit()).Should(Succeed())
+
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(db.Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+						Expect(db.Delete(key)).Should(Succeed())
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should iterate over the committed and pending key/value pairs", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(values []testutil.TestStruct) bool {
+						allValues := map[string]testutil.TestStruct{}
+						for i, value := range values {
+							key := fmt.Sprintf("%v", i)
+							allValues[key] = value
+							if i%2 == 0 {
+								Expect(db.Insert("iter_"+key, value)).Should(Succeed())
+							}
+						}
+
+						txn, err := db.NewTxn()
+						Expect(err).NotTo(HaveOccurred())
+						defer txn.Discard()
+						for i, value := range values {
+							if i%2 != 0 {
+								Expect(txn.Insert(fmt.Sprintf("iter_%v", i), value)).Should(Succeed())
+							}
+						}
+
+						iter := txn.Iterator("iter_")
+						for iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							value := testutil.TestStruct{D: []byte{}}
+							Expect(iter.Value(&value)).Should(Succeed())
+
+							stored, ok := allValues[key]
+							Expect(ok).Should(BeTrue())
+							Expect(reflect.DeepEqual(value, stored)).Should(BeTrue())
+							delete(allValues, key)
+						}
+						iter.Close()
+
+						for i := range values {
+							Expect(txn.Delete(fmt.Sprintf("iter_%v", i))).Should(Succeed())
+						}
+						Expect(txn.Commit()).Should(Succeed())
+						return len(allValues) == 0
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when doing read-modify-write concurrently", func() {
+				It("should not lose any updates", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					increment := func() error {
+						for {
+							txn, err := db.NewTxn()
+							if err != nil {
+								return err
+							}
+							var counter int64
+							if err := txn.Get("counter", &counter); err != nil && err != ErrKeyNotFound {
+								txn.Discard()
+								return err
+							}
+							if err := txn.Insert("counter", counter+1); err != nil {
+								txn.Discard()
+								return err
+							}
+							err = txn.Commit()
+							if err == ErrConflict {
+								continue
+							}
+							return err
+						}
+					}
+
+					n := 20
+					errs := make([]error, n)
+					phi.ParForAll(n, func(i int) {
+						errs[i] = increment()
+					})
+					Expect(testutil.CheckErrors(errs)).Should(BeNil())
+
+					var counter int64
+					Expect(db.Get("counter", &counter)).Should(Succeed())
+					Expect(counter).Should(Equal(int64(n)))
+				})
+			})
+
+			Context("when reading and writing multiple tables in a txn", func() {
+				It("should commit the writes of all tables atomically", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(key string, value, other testutil.TestStruct) bool {
+						first := NewTable(db, "first")
+						second := NewTable(db, "second")
+
+						txn, err := db.NewTxn()
+						Expect(err).NotTo(HaveOccurred())
+						defer txn.Discard()
+						Expect(first.Txn(txn).Insert(key, value)).Should(Succeed())
+						Expect(second.Txn(txn).Insert(key, other)).Should(Succeed())
+
+						stored := testutil.TestStruct{D: []byte{}}
+						Expect(second.Txn(txn).Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, other)).Should(BeTrue())
+						Expect(first.Get(key, &stored)).Should(Equal(ErrKeyNotFound))
+						Expect(txn.Commit()).Should(Succeed())
+
+						stored = testutil.TestStruct{D: []byte{}}
+						Expect(first.Get(key, &stored)).Should(Succeed())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+						Expect(first.Delete(key)).Should(Succeed())
+						Expect(second.Delete(key)).Should(Succeed())
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+			})
+		}
+	}
+})
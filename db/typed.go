@@ -0,0 +1,282 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A KeyEncoder encodes keys of type K into the string keys of a Table, and
+// decodes them again. Encoded keys must not be empty. If the encoding preserves
+// the order of the keys, then the Iterators of a TypedTable return key/value
+// pairs in the order of their keys.
+type KeyEncoder[K any] interface {
+
+	// EncodeKey encodes the key into a string.
+	EncodeKey(key K) (string, error)
+
+	// DecodeKey decodes a key that was encoded using EncodeKey.
+	DecodeKey(key string) (K, error)
+}
+
+// StringKeys is a KeyEncoder that uses string keys as they are.
+var StringKeys KeyEncoder[string] = stringKeys{}
+
+// Uint64Keys is a KeyEncoder that encodes uint64 keys as 8 big-endian bytes,
+// which preserves the order of the keys.
+var Uint64Keys KeyEncoder[uint64] = uint64Keys{}
+
+// Int64Keys is a KeyEncoder that encodes int64 keys as 8 big-endian bytes,
+// with the sign bit flipped, which preserves the order of the keys.
+var Int64Keys KeyEncoder[int64] = int64Keys{}
+
+type stringKeys struct{}
+
+func (stringKeys) EncodeKey(key string) (string, error) {
+	return key, nil
+}
+
+func (stringKeys) DecodeKey(key string) (string, error) {
+	return key, nil
+}
+
+type uint64Keys struct{}
+
+func (uint64Keys) EncodeKey(key uint64) (string, error) {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], key)
+	return string(data[:]), nil
+}
+
+func (uint64Keys) DecodeKey(key string) (uint64, error) {
+	if len(key) != 8 {
+		return 0, fmt.Errorf("expected key of 8 bytes, got %v bytes", len(key))
+	}
+	return binary.BigEndian.Uint64([]byte(key)), nil
+}
+
+type int64Keys struct{}
+
+func (int64Keys) EncodeKey(key int64) (string, error) {
+	return uint64Keys{}.EncodeKey(uint64(key) ^ (1 << 63))
+}
+
+func (int64Keys) DecodeKey(key string) (int64, error) {
+	x, err := uint64Keys{}.DecodeKey(key)
+	if err != nil {
+		return 0, err
+	}
+	return int64(x ^ (1 << 63)), nil
+}
+
+// A TypedTable is a type-safe wrapper over a Table, with keys of type K and
+// values of type V. Keys are encoded using a KeyEncoder, and values are encoded
+// using the Codec of the DB, so V must be a type that the Codec can encode.
+type TypedTable[K, V any] struct {
+	table Table
+	keys  KeyEncoder[K]
+}
+
+// NewTypedTable returns a TypedTable that wraps the given Table, and encodes
+// keys using the given KeyEncoder.
+func NewTypedTable[K, V any](table Table, keys KeyEncoder[K]) *TypedTable[K, V] {
+	return &TypedTable[K, V]{
+		table: table,
+		keys:  keys,
+	}
+}
+
+// Table returns the Table that is wrapped by the TypedTable.
+func (t *TypedTable[K, V]) Table() Table {
+	return t.table
+}
+
+// Insert writes the key-value into the TypedTable.
+func (t *TypedTable[K, V]) Insert(key K, value V) error {
+	k, err := t.keys.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	return t.table.Insert(k, value)
+}
+
+// Get the value associated with the given key. If the key cannot be found,
+// then ErrKeyNotFound is returned.
+func (t *TypedTable[K, V]) Get(key K) (V, error) {
+	var value V
+	k, err := t.keys.EncodeKey(key)
+	if err != nil {
+		return value, err
+	}
+	if err := t.table.Get(k, &value); err != nil {
+		var zero V
+		return zero, err
+	}
+	return value, nil
+}
+
+// Delete the value with the given key from the TypedTable.
+func (t *TypedTable[K, V]) Delete(key K) error {
+	k, err := t.keys.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	return t.table.Delete(k)
+}
+
+// Has returns whether there is a value associated with the given key.
+func (t *TypedTable[K, V]) Has(key K) (bool, error) {
+	k, err := t.keys.EncodeKey(key)
+	if err != nil {
+		return false, err
+	}
+	return t.table.Has(k)
+}
+
+// Update atomically reads, modifies and writes the value associated with the
+// given key. The function is called with the current value, or the zero value
+// if the key does not exist, and returns the new value. If the function
+// returns an error, then nothing is written and the error is returned. The
+// function can be called more than once, so it must be safe to do so.
+func (t *TypedTable[K, V]) Update(key K, fn func(value V, exists bool) (V, error)) error {
+	k, err := t.keys.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	var value V
+	return t.table.Update(k, &value, func(exists bool) error {
+		updated, err := fn(value, exists)
+		if err != nil {
+			return err
+		}
+		value = updated
+		return nil
+	})
+}
+
+// Size returns the number of key/value pairs in the TypedTable.
+func (t *TypedTable[K, V]) Size() (int, error) {
+	return t.table.Size()
+}
+
+// Iterator over the key/value pairs in the TypedTable, in lexicographic order
+// of their encoded keys.
+func (t *TypedTable[K, V]) Iterator() *TypedIterator[K, V] {
+	return t.newIterator(t.table.Iterator())
+}
+
+// RangeIterator over the key/value pairs in the TypedTable where the key is
+// greater than, or equal to, the start key and less than the end key. At most
+// limit key/value pairs are returned, unless the limit is zero. Both keys bound
+// the range, even if they are the zero value, so use IteratorWithOptions for a
+// range that is not bounded. The range is only meaningful if the KeyEncoder
+// preserves the order of the keys.
+func (t *TypedTable[K, V]) RangeIterator(start, end K, limit int) (*TypedIterator[K, V], error) {
+	return t.IteratorWithOptions(TypedIteratorOptions[K]{
+		Start: &start,
+		End:   &end,
+		Limit: limit,
+	})
+}
+
+// TypedIteratorOptions configure the range, the limit and the order of an
+// Iterator of a TypedTable. They are the same as IteratorOptions, except that
+// the bounds are keys of the TypedTable, and a nil bound does not bound the
+// range, because the zero value of a key is a valid key.
+type TypedIteratorOptions[K any] struct {
+
+	// Start is the inclusive lower bound of the keys. If it is nil, then the
+	// keys are not bounded from below.
+	Start *K
+
+	// End is the exclusive upper bound of the keys. If it is nil, then the
+	// keys are not bounded from above.
+	End *K
+
+	// Limit is the maximum number of key/value pairs returned by the Iterator.
+	// If it is zero, or negative, then the number is not limited.
+	Limit int
+
+	// Reverse iterates over the key/value pairs in reverse order of their
+	// encoded keys, starting from the largest key in the range.
+	Reverse bool
+}
+
+// IteratorWithOptions returns an Iterator over the key/value pairs in the
+// TypedTable that are in the range of the options. The range is only meaningful
+// if the KeyEncoder preserves the order of the keys.
+func (t *TypedTable[K, V]) IteratorWithOptions(opts TypedIteratorOptions[K]) (*TypedIterator[K, V], error) {
+	iterOpts := IteratorOptions{
+		Limit:   opts.Limit,
+		Reverse: opts.Reverse,
+	}
+	if opts.Start != nil {
+		start, err := t.keys.EncodeKey(*opts.Start)
+		if err != nil {
+			return nil, err
+		}
+		iterOpts.Start = start
+	}
+	if opts.End != nil {
+		end, err := t.keys.EncodeKey(*opts.End)
+		if err != nil {
+			return nil, err
+		}
+		if end == "" {
+			// An empty end does not bound the range, but no key is less than
+			// the empty key, and only the empty key is less than "\x00".
+			end = "\x00"
+		}
+		iterOpts.End = end
+	}
+	return t.newIterator(t.table.IteratorWithOptions(iterOpts)), nil
+}
+
+func (t *TypedTable[K, V]) newIterator(iter Iterator) *TypedIterator[K, V] {
+	return &TypedIterator[K, V]{
+		iter: iter,
+		keys: t.keys,
+	}
+}
+
+// A TypedIterator is used to lazily iterate over the key/value pairs of a
+// TypedTable.
+type TypedIterator[K, V any] struct {
+	iter Iterator
+	keys KeyEncoder[K]
+}
+
+// Next moves the iterator to the next key/value pair. It returns false if the
+// iterator is exhausted, or if an error occurred.
+func (iter *TypedIterator[K, V]) Next() bool {
+	return iter.iter.Next()
+}
+
+// Key of the current key/value pair.
+func (iter *TypedIterator[K, V]) Key() (K, error) {
+	key, err := iter.iter.Key()
+	if err != nil {
+		var zero K
+		return zero, err
+	}
+	return iter.keys.DecodeKey(key)
+}
+
+// Value of the current key/value pair.
+func (iter *TypedIterator[K, V]) Value() (V, error) {
+	var value V
+	if err := iter.iter.Value(&value); err != nil {
+		var zero V
+		return zero, err
+	}
+	return value, nil
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (iter *TypedIterator[K, V]) Err() error {
+	return iter.iter.Err()
+}
+
+// Close the iterator.
+func (iter *TypedIterator[K, V]) Close() {
+	iter.iter.Close()
+}
@@ -0,0 +1,175 @@
+package db_test
+
+import (
+	"reflect"
+	"sort"
+	"testing/quick"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/db"
+
+	"github.com/renproject/kv/testutil"
+)
+
+var _ = Describe("typed table", func() {
+	for i := range testutil.Codecs {
+		for j := range testutil.DbInitalizer {
+			codec := testutil.Codecs[i]
+			initializer := testutil.DbInitalizer[j]
+
+			Context("when reading and writing typed values", func() {
+				It("should return the values that were inserted", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTypedTable[string, testutil.TestStruct](NewTable(db, "typed"), StringKeys)
+					test := func(key string, value testutil.TestStruct) bool {
+						if key == "" {
+							return true
+						}
+						Expect(table.Insert(key, value)).Should(Succeed())
+						stored, err := table.Get(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(reflect.DeepEqual(stored, value)).Should(BeTrue())
+
+						Expect(table.Delete(key)).Should(Succeed())
+						ok, err := table.Has(key)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(ok).Should(BeFalse())
+						_, err = table.Get(key)
+						return err == ErrKeyNotFound
+					}
+
+					Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+				})
+
+				It("should update values using the typed value", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTypedTable[uint64, uint64](NewTable(db, "typed"), Uint64Keys)
+					for i := 0; i < 10; i++ {
+						Expect(table.Update(1, func(value uint64, exists bool) (uint64, error) {
+							Expect(exists).Should(Equal(i > 0))
+							return value + 2, nil
+						})).Should(Succeed())
+					}
+					value, err := table.Get(1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(value).Should(Equal(uint64(20)))
+				})
+			})
+
+			Context("when iterating over typed keys", func() {
+				It("should return the keys in order", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					test := func(keys []int64) bool {
+						table := NewTypedTable[int64, int64](NewTable(db, "typed"), Int64Keys)
+						defer func() {
+							Expect(table.Table().Drop()).Should(Succeed())
+						}()
+
+						unique := map[int64]bool{}
+						for _, key := range keys {
+							Expect(table.Insert(key, -key)).Should(Succeed())
+							unique[key] = true
+						}
+						expected := make([]int64, 0, len(unique))
+						for key := range unique {
+							expected = append(expected, key)
+						}
+						sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+
+						iter := table.Iterator()
+						defer iter.Close()
+						actual := []int64{}
+						for iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							value, err := iter.Value()
+							Expect(err).NotTo(HaveOccurred())
+							Expect(value).Should(Equal(-key))
+							actual = append(actual, key)
+						}
+						Expect(iter.Err()).NotTo(HaveOccurred())
+						return reflect.DeepEqual(actual, expected)
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+				})
+
+				It("should only iterate over the range of keys", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTypedTable[uint64, uint64](NewTable(db, "typed"), Uint64Keys)
+					for i := uint64(0); i < 300; i++ {
+						Expect(table.Insert(i, i)).Should(Succeed())
+					}
+
+					iter, err := table.RangeIterator(100, 260, 0)
+					Expect(err).NotTo(HaveOccurred())
+					defer iter.Close()
+					next := uint64(100)
+					for iter.Next() {
+						key, err := iter.Key()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(key).Should(Equal(next))
+						next++
+					}
+					Expect(iter.Err()).NotTo(HaveOccurred())
+					Expect(next).Should(Equal(uint64(260)))
+				})
+
+				It("should not bound the range of keys without a bound", func() {
+					db := initializer(codec)
+					defer db.Close()
+
+					table := NewTypedTable[int64, int64](NewTable(db, "typed"), Int64Keys)
+					for i := int64(-10); i < 10; i++ {
+						Expect(table.Insert(i, i)).Should(Succeed())
+					}
+					read := func(opts TypedIteratorOptions[int64]) []int64 {
+						iter, err := table.IteratorWithOptions(opts)
+						Expect(err).NotTo(HaveOccurred())
+						defer iter.Close()
+						keys := []int64{}
+						for iter.Next() {
+							key, err := iter.Key()
+							Expect(err).NotTo(HaveOccurred())
+							keys = append(keys, key)
+						}
+						Expect(iter.Err()).NotTo(HaveOccurred())
+						return keys
+					}
+
+					// The zero key is a bound like any other key.
+					zero, five := int64(0), int64(5)
+					Expect(read(TypedIteratorOptions[int64]{Start: &zero})).Should(Equal([]int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}))
+					Expect(read(TypedIteratorOptions[int64]{End: &zero, Limit: 3})).Should(Equal([]int64{-10, -9, -8}))
+					Expect(read(TypedIteratorOptions[int64]{Start: &zero, End: &five, Reverse: true})).Should(Equal([]int64{4, 3, 2, 1, 0}))
+					Expect(read(TypedIteratorOptions[int64]{Reverse: true, Limit: 2})).Should(Equal([]int64{9, 8}))
+
+					names := NewTypedTable[string, int64](NewTable(db, "names"), StringKeys)
+					Expect(names.Insert("a", 1)).Should(Succeed())
+					empty := ""
+					iter, err := names.IteratorWithOptions(TypedIteratorOptions[string]{End: &empty})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(iter.Next()).Should(BeFalse())
+					iter.Close()
+
+					uints := NewTypedTable[uint64, uint64](NewTable(db, "uints"), Uint64Keys)
+					Expect(uints.Insert(0, 0)).Should(Succeed())
+					Expect(uints.Insert(1, 1)).Should(Succeed())
+					uintIter, err := uints.RangeIterator(0, 0, 0)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(uintIter.Next()).Should(BeFalse())
+					uintIter.Close()
+				})
+			})
+		}
+	}
+})
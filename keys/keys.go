@@ -0,0 +1,227 @@
+// Package keys encodes tuples of values into strings that can be used as keys
+// in a db.Table. The encoding preserves the order of the tuples: if a tuple is
+// less than another tuple, then its encoding is lexicographically less than
+// the encoding of the other tuple. Tuples are compared element by element, and
+// a tuple that is a prefix of another tuple is less than the other tuple. The
+// encoding of a tuple is also a prefix of the encoding of every tuple that
+// extends it, so Range can be used to iterate over all keys that begin with
+// the same elements.
+//
+// Supported elements are signed integers, unsigned integers, strings, byte
+// slices, bools and timestamps. Elements of different types are ordered by
+// their type, with byte slices first, followed by strings, signed integers,
+// unsigned integers, bools and timestamps. Elements at the same position in
+// keys of the same Table should have the same type.
+package keys
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidKey is returned when decoding a key that was not encoded using
+// Encode.
+var ErrInvalidKey = errors.New("invalid key")
+
+// Type codes of the elements of a tuple. The type code of an element is
+// written before the element, so elements of different types are ordered by
+// their type codes. No type code is 0xff, so appending 0xff to an encoding
+// gives a string that is greater than the encoding of every tuple that extends
+// it.
+const (
+	codeBytes  = 0x01
+	codeString = 0x02
+	codeInt    = 0x10
+	codeUint   = 0x11
+	codeFalse  = 0x20
+	codeTrue   = 0x21
+	codeTime   = 0x30
+)
+
+// Encode the elements of a tuple into an order-preserving string. An empty
+// tuple is encoded as the empty string, which is not a valid key.
+func Encode(elems ...interface{}) (string, error) {
+	builder := new(strings.Builder)
+	for _, elem := range elems {
+		if err := encode(builder, elem); err != nil {
+			return "", err
+		}
+	}
+	return builder.String(), nil
+}
+
+// MustEncode is like Encode, but panics if an element cannot be encoded.
+func MustEncode(elems ...interface{}) string {
+	key, err := Encode(elems...)
+	if err != nil {
+		panic(fmt.Sprintf("cannot encode key, err = %v", err))
+	}
+	return key
+}
+
+// Range returns the start and end of the range of keys that begin with the
+// encoding of the given elements, including the encoding itself. The start and
+// end can be used as the bounds of a db.IteratorOptions.
+func Range(elems ...interface{}) (string, string, error) {
+	start, err := Encode(elems...)
+	if err != nil {
+		return "", "", err
+	}
+	return start, start + "\xff", nil
+}
+
+// Decode a key that was encoded using Encode into the elements of the tuple.
+// Signed integers are decoded as int64 values, unsigned integers as uint64
+// values, and timestamps as UTC time.Time values. If the key is not a valid
+// encoding, then ErrInvalidKey is returned.
+func Decode(key string) ([]interface{}, error) {
+	elems := []interface{}{}
+	for len(key) > 0 {
+		elem, rest, err := decode(key)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+		key = rest
+	}
+	return elems, nil
+}
+
+func encode(builder *strings.Builder, elem interface{}) error {
+	switch elem := elem.(type) {
+	case []byte:
+		builder.WriteByte(codeBytes)
+		writeEscaped(builder, string(elem))
+	case string:
+		builder.WriteByte(codeString)
+		writeEscaped(builder, elem)
+	case int:
+		writeInt(builder, int64(elem))
+	case int8:
+		writeInt(builder, int64(elem))
+	case int16:
+		writeInt(builder, int64(elem))
+	case int32:
+		writeInt(builder, int64(elem))
+	case int64:
+		writeInt(builder, elem)
+	case uint:
+		writeUint(builder, codeUint, uint64(elem))
+	case uint8:
+		writeUint(builder, codeUint, uint64(elem))
+	case uint16:
+		writeUint(builder, codeUint, uint64(elem))
+	case uint32:
+		writeUint(builder, codeUint, uint64(elem))
+	case uint64:
+		writeUint(builder, codeUint, elem)
+	case bool:
+		if elem {
+			builder.WriteByte(codeTrue)
+		} else {
+			builder.WriteByte(codeFalse)
+		}
+	case time.Time:
+		// Seconds are written as a signed integer, so that timestamps before
+		// the epoch are ordered correctly, followed by the nanoseconds.
+		writeUint(builder, codeTime, uint64(elem.Unix())^(1<<63))
+		var nanos [4]byte
+		binary.BigEndian.PutUint32(nanos[:], uint32(elem.Nanosecond()))
+		builder.Write(nanos[:])
+	default:
+		return fmt.Errorf("cannot encode %T", elem)
+	}
+	return nil
+}
+
+// writeEscaped writes the string terminated by 0x00. Every 0x00 in the string
+// is escaped as 0x00 0xff, so the terminator is never ambiguous and shorter
+// strings are still ordered before longer strings that they are a prefix of.
+func writeEscaped(builder *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		builder.WriteByte(s[i])
+		if s[i] == 0x00 {
+			builder.WriteByte(0xff)
+		}
+	}
+	builder.WriteByte(0x00)
+}
+
+// writeInt writes the integer as 8 big-endian bytes with the sign bit flipped,
+// so that negative integers are ordered before positive integers.
+func writeInt(builder *strings.Builder, x int64) {
+	writeUint(builder, codeInt, uint64(x)^(1<<63))
+}
+
+func writeUint(builder *strings.Builder, code byte, x uint64) {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], x)
+	builder.WriteByte(code)
+	builder.Write(data[:])
+}
+
+// decode the first element of the key, and return it with the rest of the
+// key.
+func decode(key string) (interface{}, string, error) {
+	switch key[0] {
+	case codeBytes:
+		s, rest, err := readEscaped(key[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		return []byte(s), rest, nil
+	case codeString:
+		return readEscaped(key[1:])
+	case codeInt:
+		x, rest, err := readUint(key[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		return int64(x ^ (1 << 63)), rest, nil
+	case codeUint:
+		return readUint(key[1:])
+	case codeFalse:
+		return false, key[1:], nil
+	case codeTrue:
+		return true, key[1:], nil
+	case codeTime:
+		secs, rest, err := readUint(key[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		if len(rest) < 4 {
+			return nil, "", ErrInvalidKey
+		}
+		nanos := binary.BigEndian.Uint32([]byte(rest[:4]))
+		return time.Unix(int64(secs^(1<<63)), int64(nanos)).UTC(), rest[4:], nil
+	default:
+		return nil, "", ErrInvalidKey
+	}
+}
+
+func readEscaped(key string) (string, string, error) {
+	builder := new(strings.Builder)
+	for i := 0; i < len(key); i++ {
+		if key[i] != 0x00 {
+			builder.WriteByte(key[i])
+			continue
+		}
+		if i+1 < len(key) && key[i+1] == 0xff {
+			builder.WriteByte(0x00)
+			i++
+			continue
+		}
+		return builder.String(), key[i+1:], nil
+	}
+	return "", "", ErrInvalidKey
+}
+
+func readUint(key string) (uint64, string, error) {
+	if len(key) < 8 {
+		return 0, "", ErrInvalidKey
+	}
+	return binary.BigEndian.Uint64([]byte(key[:8])), key[8:], nil
+}
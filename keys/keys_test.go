@@ -0,0 +1,139 @@
+package keys_test
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing/quick"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/kv/keys"
+
+	"github.com/renproject/kv/codec"
+	"github.com/renproject/kv/db"
+	"github.com/renproject/kv/memdb"
+)
+
+var _ = Describe("keys", func() {
+	Context("when encoding tuples", func() {
+		It("should decode the elements that were encoded", func() {
+			test := func(i int64, u uint64, s string, b []byte, ok bool, secs int64, nanos uint32) bool {
+				if b == nil {
+					b = []byte{}
+				}
+				t := time.Unix(secs, int64(nanos%1e9)).UTC()
+				key, err := Encode(i, u, s, b, ok, t)
+				Expect(err).NotTo(HaveOccurred())
+
+				elems, err := Decode(key)
+				Expect(err).NotTo(HaveOccurred())
+				return reflect.DeepEqual(elems, []interface{}{i, u, s, b, ok, t})
+			}
+
+			Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+		})
+
+		It("should decode integers of every size as int64 and uint64", func() {
+			elems, err := Decode(MustEncode(int(-1), int8(-2), int16(3), int32(-4), uint(5), uint8(6), uint16(7), uint32(8)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(elems).Should(Equal([]interface{}{int64(-1), int64(-2), int64(3), int64(-4), uint64(5), uint64(6), uint64(7), uint64(8)}))
+		})
+
+		It("should return an error for unsupported types", func() {
+			_, err := Encode("a", 1.5)
+			Expect(err).Should(HaveOccurred())
+			Expect(func() { MustEncode(struct{}{}) }).Should(Panic())
+		})
+
+		It("should return ErrInvalidKey for invalid keys", func() {
+			for _, key := range []string{"\xff", "\x02abc", "\x10\x00", MustEncode(time.Now())[:5]} {
+				_, err := Decode(key)
+				Expect(err).Should(Equal(ErrInvalidKey))
+			}
+		})
+	})
+
+	Context("when comparing encoded tuples", func() {
+		It("should preserve the order of integers", func() {
+			test := func(x, y int64, u, v uint64) bool {
+				Expect(MustEncode(x) < MustEncode(y)).Should(Equal(x < y))
+				Expect(MustEncode(u) < MustEncode(v)).Should(Equal(u < v))
+				return true
+			}
+
+			Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			Expect(MustEncode(math.MinInt64) < MustEncode(-1)).Should(BeTrue())
+			Expect(MustEncode(-1) < MustEncode(0)).Should(BeTrue())
+			Expect(MustEncode(9) < MustEncode(10)).Should(BeTrue())
+		})
+
+		It("should preserve the order of strings and byte slices", func() {
+			test := func(x, y string) bool {
+				Expect(MustEncode(x) < MustEncode(y)).Should(Equal(x < y))
+				Expect(MustEncode([]byte(x)) < MustEncode([]byte(y))).Should(Equal(x < y))
+				return true
+			}
+
+			Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			Expect(MustEncode("a") < MustEncode("a\x00")).Should(BeTrue())
+			Expect(MustEncode("a\x00") < MustEncode("a\x00\x00")).Should(BeTrue())
+			Expect(MustEncode("a\x00", "z") < MustEncode("a\x01")).Should(BeTrue())
+		})
+
+		It("should preserve the order of timestamps", func() {
+			test := func(x, y int64, m, n uint32) bool {
+				s := time.Unix(x/2, int64(m%1e9))
+				t := time.Unix(y/2, int64(n%1e9))
+				Expect(MustEncode(s) < MustEncode(t)).Should(Equal(s.Before(t)))
+				return true
+			}
+
+			Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+		})
+
+		It("should order tuples element by element", func() {
+			test := func(a, b string, x, y int64) bool {
+				expected := a < b || (a == b && x < y)
+				Expect(MustEncode(a, x) < MustEncode(b, y)).Should(Equal(expected))
+				Expect(MustEncode(a) < MustEncode(a, x)).Should(BeTrue())
+				return true
+			}
+
+			Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+			Expect(MustEncode(false) < MustEncode(true)).Should(BeTrue())
+		})
+	})
+
+	Context("when iterating over a range of tuples in a table", func() {
+		It("should only return the tuples with the same prefix, in order", func() {
+			database := memdb.New(codec.JSONCodec)
+			defer database.Close()
+
+			table := db.NewTable(database, "txs")
+			for _, account := range []string{"a", "a\x00", "ab", "b"} {
+				for i := 12; i >= 0; i-- {
+					Expect(table.Insert(MustEncode(account, i), fmt.Sprintf("%v/%v", account, i))).Should(Succeed())
+				}
+			}
+
+			start, end, err := Range("a")
+			Expect(err).NotTo(HaveOccurred())
+			iter := table.IteratorWithOptions(db.IteratorOptions{Start: start, End: end})
+			defer iter.Close()
+
+			i := int64(0)
+			for iter.Next() {
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				elems, err := Decode(key)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(elems).Should(Equal([]interface{}{"a", i}))
+				i++
+			}
+			Expect(iter.Err()).NotTo(HaveOccurred())
+			Expect(i).Should(Equal(int64(13)))
+		})
+	})
+})
@@ -23,6 +23,41 @@ var (
 	// ErrIndexOutOfRange is returned when the iterator index is less than zero,
 	// or, greater than or equal to the size of the iterator.
 	ErrIndexOutOfRange = db.ErrIndexOutOfRange
+
+	// ErrConflict is returned when a transaction cannot be committed, because
+	// a key that it read has been modified since it was created.
+	ErrConflict = db.ErrConflict
+
+	// ErrTxnDone is returned when using a transaction that has already been
+	// committed or discarded.
+	ErrTxnDone = db.ErrTxnDone
+
+	// ErrClosed is returned when a DB is used after it has been closed.
+	ErrClosed = db.ErrClosed
+
+	// ErrInvalidCursor is returned when a scan cursor was not returned by a
+	// previous scan.
+	ErrInvalidCursor = db.ErrInvalidCursor
+
+	// ErrUnknownMergeFunc is returned when merging with a merge function that
+	// has not been registered.
+	ErrUnknownMergeFunc = db.ErrUnknownMergeFunc
+
+	// ErrBatchNotCounted is returned when writing to a counted table in a
+	// batch of another table.
+	ErrBatchNotCounted = db.ErrBatchNotCounted
+
+	// ErrTableNotFound is returned when a table has not been registered.
+	ErrTableNotFound = db.ErrTableNotFound
+
+	// ErrUnknownIndex is returned when looking up keys by an index that the
+	// indexed table was not created with.
+	ErrUnknownIndex = db.ErrUnknownIndex
+
+	// ErrUniqueViolation is wrapped by the error that is returned when
+	// inserting a value would index two keys by the same value in a unique
+	// index.
+	ErrUniqueViolation = db.ErrUniqueViolation
 )
 
 type (
@@ -39,8 +74,68 @@ type (
 
 	// An Iterator is used to lazily iterate over key/value pairs.
 	Iterator = db.Iterator
+
+	// IteratorOptions restrict the key/value pairs returned by an Iterator.
+	IteratorOptions = db.IteratorOptions
+
+	// An Entry is a key/value pair in a page returned by Scan.
+	Entry = db.Entry
+
+	// FilterOptions restrict the key/value pairs returned by a filtered
+	// Iterator.
+	FilterOptions = db.FilterOptions
+
+	// Stats about the key/value pairs in a DB where the key begins with a
+	// prefix.
+	Stats = db.Stats
+
+	// A Batch is a group of writes that are committed to a DB atomically.
+	Batch = db.Batch
+
+	// A Txn is a read/write transaction over multiple key/value pairs.
+	Txn = db.Txn
+
+	// A Snapshot is a read-only view of a DB at a point in time.
+	Snapshot = db.Snapshot
+
+	// A MergeFunc merges a new value into the existing value of a key.
+	MergeFunc = db.MergeFunc
+
+	// A CountedTable is a Table that maintains the number of key/value pairs in
+	// it, so that its size can be read in constant time.
+	CountedTable = db.CountedTable
+
+	// TableMetadata is recorded in the registry of a DB when a table is first
+	// used.
+	TableMetadata = db.TableMetadata
+
+	// An IndexedTable is a table that maintains secondary indexes of its
+	// key/value pairs.
+	IndexedTable = db.IndexedTable
+
+	// An Index of an IndexedTable.
+	Index = db.Index
+
+	// An IndexFunc returns the values by which a value is indexed.
+	IndexFunc = db.IndexFunc
 )
 
+// Merge functions
+const (
+	// MergeAdd adds int64 values.
+	MergeAdd = db.MergeAdd
+
+	// MergeMax keeps the largest of int64 values.
+	MergeMax = db.MergeMax
+
+	// MergeAppend appends lists of byte slices.
+	MergeAppend = db.MergeAppend
+)
+
+// RegisterMergeFunc makes a merge function available to all DBs by the given
+// name.
+var RegisterMergeFunc = db.RegisterMergeFunc
+
 // Codecs
 var (
 	// BinaryCodec is a binary codec that marshals and unmarshals values using
@@ -72,8 +167,38 @@ var (
 	// levelDB. For more information, see https://github.com/syndtr/goleveldb.
 	NewLevelDB = leveldb.New
 
+	// NewLevelDBWithOptions returns a key-value database that is implemented
+	// using levelDB, and configured using the given options.
+	NewLevelDBWithOptions = leveldb.NewWithOptions
+
 	// NewTable returns a new table basing on the given DB and codec.
 	NewTable = db.NewTable
+
+	// NewCountedTable returns a new table that maintains the number of
+	// key/value pairs in it.
+	NewCountedTable = db.NewCountedTable
+
+	// NewIndexedTable returns a new table that maintains secondary indexes of
+	// the key/value pairs in the given table.
+	NewIndexedTable = db.NewIndexedTable
+)
+
+// FilterIterator returns an Iterator over the key/value pairs of the given
+// Iterator that are accepted by the options.
+var FilterIterator = db.FilterIterator
+
+// Table registry
+var (
+	// ListTables returns the metadata of all tables that have been registered
+	// in a DB.
+	ListTables = db.ListTables
+
+	// TableInfo returns the metadata of the table with the given name.
+	TableInfo = db.TableInfo
+
+	// RegisterTable records the metadata of the table with the given name,
+	// unless it has already been registered.
+	RegisterTable = db.RegisterTable
 )
 
 var (
@@ -1,6 +1,7 @@
 package kv_test
 
 import (
+	"fmt"
 	"math/rand"
 	"reflect"
 	"testing"
@@ -73,14 +74,14 @@ func benchmarkDB(database db.DB) {
 	vals := make([]testutil.TestStruct, benchmarkWrites)
 
 	for i := 0; i < benchmarkWrites; i++ {
-		newKey := key + string(i)
+		newKey := key + fmt.Sprint(i)
 		vals[i] = testutil.RandomTestStruct()
 		Expect(database.Insert(newKey, vals[i])).NotTo(HaveOccurred())
 	}
 
 	for i := 0; i < benchmarkReads; i++ {
 		queryIndex := rand.Intn(benchmarkWrites)
-		queryKey := key + string(queryIndex)
+		queryKey := key + fmt.Sprint(queryIndex)
 		val := testutil.TestStruct{D: []byte{}}
 		err := database.Get(queryKey, &val)
 		Expect(err).NotTo(HaveOccurred())
@@ -94,14 +95,14 @@ func benchmarkTable(table db.Table) {
 	vals := make([]testutil.TestStruct, benchmarkWrites)
 
 	for i := 0; i < benchmarkWrites; i++ {
-		newKey := key + string(i)
+		newKey := key + fmt.Sprint(i)
 		vals[i] = testutil.RandomTestStruct()
 		Expect(table.Insert(newKey, vals[i])).NotTo(HaveOccurred())
 	}
 
 	for i := 0; i < benchmarkReads; i++ {
 		queryIndex := rand.Intn(benchmarkWrites)
-		queryKey := key + string(queryIndex)
+		queryKey := key + fmt.Sprint(queryIndex)
 		val := testutil.TestStruct{D: []byte{}}
 		err := table.Get(queryKey, &val)
 		Expect(err).NotTo(HaveOccurred())
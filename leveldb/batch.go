@@ -0,0 +1,67 @@
+package leveldb
+
+import (
+	"strings"
+
+	"github.com/renproject/kv/db"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// batch is a leveldb implementation of the `db.Batch`. It is backed by a
+// native `leveldb.Batch`, which leveldb writes atomically. Writes to the
+// reserved key-space are counted separately, so that they are not included in
+// the length of the batch.
+type batch struct {
+	ldb      *levelDB
+	batch    *leveldb.Batch
+	reserved int
+}
+
+// Insert implements the `db.Batch` interface.
+func (batch *batch) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := batch.ldb.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	batch.batch.Put([]byte(key), data)
+	batch.count(key)
+	return nil
+}
+
+// Delete implements the `db.Batch` interface.
+func (batch *batch) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	batch.batch.Delete([]byte(key))
+	batch.count(key)
+	return nil
+}
+
+// Len implements the `db.Batch` interface.
+func (batch *batch) Len() int {
+	return batch.batch.Len() - batch.reserved
+}
+
+// count records a write to the key if it is in the reserved key-space.
+func (batch *batch) count(key string) {
+	if strings.HasPrefix(key, db.ReservedPrefix) {
+		batch.reserved++
+	}
+}
+
+// Commit implements the `db.Batch` interface.
+func (batch *batch) Commit() error {
+	batch.ldb.stripes.lockAll()
+	defer batch.ldb.stripes.unlockAll()
+
+	if err := batch.ldb.db.Write(batch.batch, nil); err != nil {
+		return err
+	}
+	batch.batch.Reset()
+	batch.reserved = 0
+	return nil
+}
@@ -2,6 +2,7 @@ package leveldb
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 
 	"github.com/renproject/kv/db"
@@ -10,14 +11,37 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// deletePrefixBatchSize is the maximum number of keys that are deleted in one
+// batch by DeletePrefix.
+const deletePrefixBatchSize = 1000
+
+// reserved is the range of keys in the reserved key-space of the DB.
+var reserved = util.BytesPrefix([]byte(db.ReservedPrefix))
+
+// Options for a leveldb implementation of the `db.DB`.
+type Options struct {
+
+	// CompactOnDeletePrefix compacts the range of keys that begin with the
+	// prefix after they have been deleted by DeletePrefix. This reclaims disk
+	// space immediately, at the cost of making DeletePrefix slower.
+	CompactOnDeletePrefix bool
+}
+
 // levelDB is a leveldb implementation of the `db.Iterable`.
 type levelDB struct {
-	db    *leveldb.DB
-	codec db.Codec
+	db      *leveldb.DB
+	codec   db.Codec
+	opts    Options
+	stripes *stripes
 }
 
 // New returns a new `db.Iterable`.
 func New(path string, codec db.Codec) db.DB {
+	return NewWithOptions(path, codec, Options{})
+}
+
+// NewWithOptions returns a new `db.Iterable` that uses the given options.
+func NewWithOptions(path string, codec db.Codec, opts Options) db.DB {
 	if codec == nil {
 		panic("codec cannot be nil")
 	}
@@ -28,8 +52,10 @@ func New(path string, codec db.Codec) db.DB {
 	}
 
 	return &levelDB{
-		db:    ldb,
-		codec: codec,
+		db:      ldb,
+		codec:   codec,
+		opts:    opts,
+		stripes: new(stripes),
 	}
 }
 
@@ -37,24 +63,225 @@ func (ldb *levelDB) Close() error {
 	return ldb.db.Close()
 }
 
+// Codec implements the `db.DB` interface.
+func (ldb *levelDB) Codec() db.Codec {
+	return ldb.codec
+}
+
 // Insert implements the `db.DB` interface.
 func (ldb *levelDB) Insert(key string, value interface{}) error {
+	return ldb.InsertContext(context.Background(), key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (ldb *levelDB) Get(key string, value interface{}) error {
+	return ldb.GetContext(context.Background(), key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (ldb *levelDB) Delete(key string) error {
+	return ldb.DeleteContext(context.Background(), key)
+}
+
+// InsertIfAbsent implements the `db.DB` interface.
+func (ldb *levelDB) InsertIfAbsent(key string, value interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	data, err := ldb.codec.Encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	defer ldb.stripes.lock(key)()
+	if ok, err := ldb.db.Has([]byte(key), nil); ok || err != nil {
+		return false, err
+	}
+	return true, ldb.db.Put([]byte(key), data, nil)
+}
+
+// DeleteIfEquals implements the `db.DB` interface.
+func (ldb *levelDB) DeleteIfEquals(key string, value interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	defer ldb.stripes.lock(key)()
+	if ok, err := ldb.equals(key, value); !ok || err != nil {
+		return false, err
+	}
+	return true, ldb.db.Delete([]byte(key), nil)
+}
+
+// CompareAndSwap implements the `db.DB` interface.
+func (ldb *levelDB) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	data, err := ldb.codec.Encode(new)
+	if err != nil {
+		return false, err
+	}
+
+	defer ldb.stripes.lock(key)()
+	if ok, err := ldb.equals(key, old); !ok || err != nil {
+		return false, err
+	}
+	return true, ldb.db.Put([]byte(key), data, nil)
+}
+
+// Merge implements the `db.DB` interface.
+func (ldb *levelDB) Merge(key, name string, value interface{}) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
+
+	defer ldb.stripes.lock(key)()
+	existing, err := ldb.db.Get([]byte(key), nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return err
+	}
+	data, err := db.MergeValue(ldb.codec, name, existing, value)
+	if err != nil {
+		return err
+	}
+	return ldb.db.Put([]byte(key), data, nil)
+}
+
+// DeletePrefix implements the `db.DB` interface. Keys are deleted in batches,
+// and each batch holds all of the stripes while it is written, so conditional
+// writes are never interleaved with a batch.
+func (ldb *levelDB) DeletePrefix(prefix string) error {
+	iter := hide(prefix, ldb.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil))
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	write := func() error {
+		ldb.stripes.lockAll()
+		defer ldb.stripes.unlockAll()
+
+		err := ldb.db.Write(batch, nil)
+		batch.Reset()
+		return err
+	}
+	for iter.Next() {
+		batch.Delete(iter.Key())
+		if batch.Len() >= deletePrefixBatchSize {
+			if err := write(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if batch.Len() > 0 {
+		if err := write(); err != nil {
+			return err
+		}
+	}
+
+	if ldb.opts.CompactOnDeletePrefix {
+		return ldb.db.CompactRange(*util.BytesPrefix([]byte(prefix)))
+	}
+	return nil
+}
+
+// equals returns whether the value associated with the key is equal to the
+// given value. It must be called while holding the lock of the stripe of the
+// key.
+func (ldb *levelDB) equals(key string, value interface{}) (bool, error) {
+	data, err := ldb.db.Get([]byte(key), nil)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return db.EqualValue(ldb.codec, data, value)
+}
+
+// Has implements the `db.DB` interface.
+func (ldb *levelDB) Has(key string) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	return ldb.db.Has([]byte(key), nil)
+}
+
+// Size implements the `db.DB` interface.
+func (ldb *levelDB) Size(prefix string) (int, error) {
+	return ldb.SizeContext(context.Background(), prefix)
+}
+
+// Stats implements the `db.DB` interface. The disk bytes are approximated by
+// leveldb from the tables that overlap with the prefix, so they do not include
+// recent writes that are still in memory.
+func (ldb *levelDB) Stats(prefix string) (db.Stats, error) {
+	r := util.BytesPrefix([]byte(prefix))
+	iter := hide(prefix, ldb.db.NewIterator(r, nil))
+	defer iter.Release()
+
+	stats := db.Stats{}
+	for iter.Next() {
+		stats.Keys++
+		stats.KeyBytes += int64(len(iter.Key()))
+		stats.ValueBytes += int64(len(iter.Value()))
+	}
+	if err := iter.Error(); err != nil {
+		return db.Stats{}, err
+	}
+
+	ranges := []util.Range{*r}
+	if db.HidesReserved(prefix) {
+		ranges = append(ranges, *reserved)
+	}
+	sizes, err := ldb.db.SizeOf(ranges)
+	if err != nil {
+		return db.Stats{}, err
+	}
+	stats.DiskBytes = sizes[0]
+	if len(sizes) > 1 {
+		stats.DiskBytes -= sizes[1]
+	}
+	return stats, nil
+}
+
+// Iterator implements the `db.DB` interface.
+func (ldb *levelDB) Iterator(prefix string) db.Iterator {
+	return ldb.IteratorContext(context.Background(), prefix, db.IteratorOptions{})
+}
+
+// IteratorWithOptions implements the `db.DB` interface.
+func (ldb *levelDB) IteratorWithOptions(prefix string, opts db.IteratorOptions) db.Iterator {
+	return ldb.IteratorContext(context.Background(), prefix, opts)
+}
+
+// InsertContext implements the `db.DB` interface.
+func (ldb *levelDB) InsertContext(ctx context.Context, key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	data, err := ldb.codec.Encode(value)
 	if err != nil {
 		return err
 	}
 
+	defer ldb.stripes.lock(key)()
 	return ldb.db.Put([]byte(key), data, nil)
 }
 
-// Get implements the `db.DB` interface.
-func (ldb *levelDB) Get(key string, value interface{}) error {
+// GetContext implements the `db.DB` interface.
+func (ldb *levelDB) GetContext(ctx context.Context, key string, value interface{}) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	data, err := ldb.db.Get([]byte(key), nil)
 	if err != nil {
@@ -64,54 +291,267 @@ func (ldb *levelDB) Get(key string, value interface{}) error {
 	return ldb.codec.Decode(data, value)
 }
 
-// Delete implements the `db.DB` interface.
-func (ldb *levelDB) Delete(key string) error {
+// DeleteContext implements the `db.DB` interface.
+func (ldb *levelDB) DeleteContext(ctx context.Context, key string) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	defer ldb.stripes.lock(key)()
 	return ldb.db.Delete([]byte(key), nil)
 }
 
-// Size implements the `db.DB` interface.
-func (ldb *levelDB) Size(prefix string) (int, error) {
-	iter := ldb.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+// SizeContext implements the `db.DB` interface.
+func (ldb *levelDB) SizeContext(ctx context.Context, prefix string) (int, error) {
+	return size(ctx, hide(prefix, ldb.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)))
+}
+
+// IteratorContext implements the `db.DB` interface.
+func (ldb *levelDB) IteratorContext(ctx context.Context, prefix string, opts db.IteratorOptions) db.Iterator {
+	iterator := hide(prefix, ldb.db.NewIterator(rangeOf(prefix, opts), nil))
+	return &iter{
+		ctx:     ctx,
+		prefix:  []byte(prefix),
+		limit:   opts.Limit,
+		reverse: opts.Reverse,
+		iter:    iterator,
+		codec:   ldb.codec,
+	}
+}
+
+// InsertRaw implements the `db.DB` interface.
+func (ldb *levelDB) InsertRaw(key string, data []byte) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	defer ldb.stripes.lock(key)()
+	return ldb.db.Put([]byte(key), data, nil)
+}
+
+// GetRaw implements the `db.DB` interface.
+func (ldb *levelDB) GetRaw(key string) ([]byte, error) {
+	if key == "" {
+		return nil, db.ErrEmptyKey
+	}
+	data, err := ldb.db.Get([]byte(key), nil)
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	return data, nil
+}
+
+// NewBatch implements the `db.DB` interface.
+func (ldb *levelDB) NewBatch() db.Batch {
+	return &batch{
+		ldb:   ldb,
+		batch: new(leveldb.Batch),
+	}
+}
+
+// NewTxn implements the `db.DB` interface. Only one txn can be open at a time,
+// and all other writes to the DB are blocked until it is done.
+func (ldb *levelDB) NewTxn() (db.Txn, error) {
+	ldb.stripes.lockAll()
+	return &txn{
+		ldb:    ldb,
+		writes: map[string]write{},
+	}, nil
+}
+
+// Snapshot implements the `db.DB` interface.
+func (ldb *levelDB) Snapshot() (db.Snapshot, error) {
+	snap, err := ldb.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{
+		ldb:  ldb,
+		snap: snap,
+	}, nil
+}
+
+// size returns the number of key/value pairs in the iterator, and releases it.
+// It stops counting once the context is done.
+func size(ctx context.Context, iter iterator.Iterator) (int, error) {
 	defer iter.Release()
 
 	counter := 0
 	for iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
 		counter++
 	}
-	return counter, nil
+	return counter, iter.Error()
 }
 
-// Iterator implements the `db.DB` interface.
-func (ldb *levelDB) Iterator(prefix string) db.Iterator {
-	iterator := ldb.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
-	return &iter{
-		prefix: []byte(prefix),
-		iter:   iterator,
-		codec:  ldb.codec,
+// rangeOf returns the range of keys that begin with the prefix, and are in the
+// range of the options.
+func rangeOf(prefix string, opts db.IteratorOptions) *util.Range {
+	r := util.BytesPrefix([]byte(prefix))
+	if opts.Start != "" {
+		r.Start = []byte(prefix + opts.Start)
+	}
+	if opts.End != "" {
+		r.Limit = []byte(prefix + opts.End)
 	}
+	return r
+}
+
+// hide returns the iterator over the keys that begin with the prefix, wrapped
+// so that it skips the reserved key-space if reads of the prefix hide it.
+func hide(prefix string, it iterator.Iterator) iterator.Iterator {
+	if !db.HidesReserved(prefix) {
+		return it
+	}
+	return &hiddenIterator{Iterator: it}
+}
+
+// hiddenIterator is an iterator that skips the reserved key-space, by seeking
+// past it whenever it moves into it.
+type hiddenIterator struct {
+	iterator.Iterator
+}
+
+func (it *hiddenIterator) First() bool {
+	return it.forward(it.Iterator.First())
+}
+
+func (it *hiddenIterator) Last() bool {
+	return it.backward(it.Iterator.Last())
+}
+
+func (it *hiddenIterator) Seek(key []byte) bool {
+	return it.forward(it.Iterator.Seek(key))
+}
+
+func (it *hiddenIterator) Next() bool {
+	return it.forward(it.Iterator.Next())
+}
+
+func (it *hiddenIterator) Prev() bool {
+	return it.backward(it.Iterator.Prev())
+}
+
+// forward moves to the first key after the reserved key-space if the iterator
+// is in it.
+func (it *hiddenIterator) forward(ok bool) bool {
+	if !ok || !bytes.HasPrefix(it.Key(), reserved.Start) {
+		return ok
+	}
+	return it.Iterator.Seek(reserved.Limit)
+}
+
+// backward moves to the last key before the reserved key-space if the iterator
+// is in it. Seeking to the start of the reserved key-space always finds a key,
+// because the iterator is at a key in it.
+func (it *hiddenIterator) backward(ok bool) bool {
+	if !ok || !bytes.HasPrefix(it.Key(), reserved.Start) {
+		return ok
+	}
+	it.Iterator.Seek(reserved.Start)
+	return it.Iterator.Prev()
 }
 
 // iter implements the `db.Iterator` interface.
 type iter struct {
-	prefix []byte
-	iter   iterator.Iterator
-	codec  db.Codec
+	ctx     context.Context
+	prefix  []byte
+	limit   int
+	count   int
+	reverse bool
+	iter    iterator.Iterator
+	codec   db.Codec
+
+	// released is true once the iterator has been released, after which err
+	// is the error that it stopped with.
+	released bool
+	err      error
 }
 
 // Next implements the `db.Iterator` interface.
 func (iter *iter) Next() bool {
-	next := iter.iter.Next()
+	if iter.released || iter.done() {
+		return false
+	}
+	next := false
+	if iter.limit <= 0 || iter.count < iter.limit {
+		switch {
+		case !iter.reverse:
+			next = iter.iter.Next()
+		case iter.count == 0:
+			next = iter.iter.Last()
+		default:
+			next = iter.iter.Prev()
+		}
+		iter.count++
+	}
 
 	// Release the iter when it finishes iterating.
 	if !next {
-		iter.iter.Release()
+		iter.Close()
 	}
 	return next
 }
 
+// Seek implements the `db.Iterator` interface.
+func (iter *iter) Seek(key string) bool {
+	if iter.released || iter.done() {
+		return false
+	}
+	iter.count = 1
+	target := append(append([]byte{}, iter.prefix...), key...)
+	ok := iter.iter.Seek(target)
+	if !iter.reverse {
+		return ok
+	}
+
+	// Seeking finds the first key that is greater than, or equal to, the
+	// target, so a reverse iter needs to step back unless it found the target.
+	switch {
+	case !ok:
+		return iter.iter.Last()
+	case bytes.Equal(iter.iter.Key(), target):
+		return true
+	default:
+		return iter.iter.Prev()
+	}
+}
+
+// First implements the `db.Iterator` interface.
+func (iter *iter) First() bool {
+	if iter.released || iter.done() {
+		return false
+	}
+	iter.count = 1
+	return iter.iter.First()
+}
+
+// Last implements the `db.Iterator` interface.
+func (iter *iter) Last() bool {
+	if iter.released || iter.done() {
+		return false
+	}
+	iter.count = 1
+	return iter.iter.Last()
+}
+
+// done returns whether the context of the iter is done, in which case the iter
+// is released with the error of the context.
+func (iter *iter) done() bool {
+	err := iter.ctx.Err()
+	if err == nil {
+		return false
+	}
+	iter.Close()
+	iter.err = err
+	return true
+}
+
 // Key implements the `db.Iterator` interface.
 func (iter *iter) Key() (string, error) {
 	key := iter.iter.Key()
@@ -130,8 +570,30 @@ func (iter *iter) Value(value interface{}) error {
 	return iter.codec.Decode(val, value)
 }
 
+// ValueBytes implements the `db.Iterator` interface.
+func (iter *iter) ValueBytes() ([]byte, error) {
+	val := iter.iter.Value()
+	if val == nil {
+		return nil, db.ErrIndexOutOfRange
+	}
+	return append([]byte{}, val...), nil
+}
+
+// Err implements the `db.Iterator` interface.
+func (iter *iter) Err() error {
+	if iter.released {
+		return iter.err
+	}
+	return convertErr(iter.iter.Error())
+}
+
 // Close implements the `db.Iterator` interface.
 func (iter *iter) Close() {
+	if iter.released {
+		return
+	}
+	iter.released = true
+	iter.err = convertErr(iter.iter.Error())
 	iter.iter.Release()
 }
 
@@ -140,6 +602,8 @@ func convertErr(err error) error {
 	switch err {
 	case leveldb.ErrNotFound:
 		return db.ErrKeyNotFound
+	case leveldb.ErrClosed:
+		return db.ErrClosed
 	default:
 		return err
 	}
@@ -156,6 +156,93 @@ var _ = Describe("level DB implementation of the db", func() {
 			})
 		})
 
+		Context("when compacting after deleting by prefix", func() {
+			It("should delete the keys that begin with the prefix", func() {
+				levelDB := NewWithOptions(".leveldb", codec, Options{CompactOnDeletePrefix: true})
+				defer levelDB.Close()
+
+				for i := 0; i < 100; i++ {
+					Expect(levelDB.Insert(fmt.Sprintf("a%v", i), testutil.RandomTestStruct())).Should(Succeed())
+					Expect(levelDB.Insert(fmt.Sprintf("b%v", i), testutil.RandomTestStruct())).Should(Succeed())
+				}
+				Expect(levelDB.DeletePrefix("a")).Should(Succeed())
+
+				size, err := levelDB.Size("a")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(0))
+				size, err = levelDB.Size("b")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).Should(Equal(100))
+			})
+		})
+
+		Context("when iterating over a txn with buffered writes", func() {
+			It("should merge the writes into the key/value pairs in order", func() {
+				levelDB := New(".leveldb", codec)
+				defer levelDB.Close()
+
+				for _, key := range []string{"p_a", "p_c", "p_e", "q_a"} {
+					Expect(levelDB.Insert(key, uint64(1))).Should(Succeed())
+				}
+				txn, err := levelDB.NewTxn()
+				Expect(err).NotTo(HaveOccurred())
+				defer txn.Discard()
+				Expect(txn.Insert("p_b", uint64(2))).Should(Succeed())
+				Expect(txn.Insert("p_c", uint64(2))).Should(Succeed())
+				Expect(txn.Delete("p_e")).Should(Succeed())
+				Expect(txn.Insert("q_b", uint64(2))).Should(Succeed())
+
+				iter := txn.Iterator("p_")
+				defer iter.Close()
+				pairs := map[string]uint64{}
+				keys := []string{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					var value uint64
+					Expect(iter.Value(&value)).Should(Succeed())
+					keys = append(keys, key)
+					pairs[key] = value
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				Expect(keys).Should(Equal([]string{"a", "b", "c"}))
+				Expect(pairs).Should(Equal(map[string]uint64{"a": 1, "b": 2, "c": 2}))
+
+				iter = txn.Iterator("p_")
+				defer iter.Close()
+				Expect(iter.Last()).Should(BeTrue())
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(Equal("c"))
+
+				Expect(iter.Seek("b")).Should(BeTrue())
+				key, err = iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(Equal("b"))
+				Expect(iter.Next()).Should(BeTrue())
+				key, err = iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(Equal("c"))
+				Expect(iter.Next()).Should(BeFalse())
+			})
+		})
+
+		Context("when the db has been closed", func() {
+			It("should return an error when sizing or iterating", func() {
+				levelDB := New(".leveldb", codec)
+				Expect(levelDB.Insert("key", testutil.RandomTestStruct())).Should(Succeed())
+				Expect(levelDB.Close()).Should(Succeed())
+
+				_, err := levelDB.Size("")
+				Expect(err).Should(HaveOccurred())
+
+				iter := levelDB.Iterator("")
+				defer iter.Close()
+				Expect(iter.Next()).Should(BeFalse())
+				Expect(iter.Err()).Should(HaveOccurred())
+			})
+		})
+
 		Context("when trying to create more than one db using the same path", func() {
 			It("should panic", func() {
 				levelDB := New(".leveldb", codec)
@@ -0,0 +1,49 @@
+package leveldb
+
+import (
+	"context"
+
+	"github.com/renproject/kv/db"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// snapshot is a leveldb implementation of the `db.Snapshot`. It is backed by a
+// native `leveldb.Snapshot`.
+type snapshot struct {
+	ldb  *levelDB
+	snap *leveldb.Snapshot
+}
+
+// Get implements the `db.Snapshot` interface.
+func (snapshot *snapshot) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	data, err := snapshot.snap.Get([]byte(key), nil)
+	if err != nil {
+		return convertErr(err)
+	}
+	return snapshot.ldb.codec.Decode(data, value)
+}
+
+// Size implements the `db.Snapshot` interface.
+func (snapshot *snapshot) Size(prefix string) (int, error) {
+	return size(context.Background(), hide(prefix, snapshot.snap.NewIterator(util.BytesPrefix([]byte(prefix)), nil)))
+}
+
+// Iterator implements the `db.Snapshot` interface.
+func (snapshot *snapshot) Iterator(prefix string) db.Iterator {
+	return &iter{
+		ctx:    context.Background(),
+		prefix: []byte(prefix),
+		iter:   hide(prefix, snapshot.snap.NewIterator(util.BytesPrefix([]byte(prefix)), nil)),
+		codec:  snapshot.ldb.codec,
+	}
+}
+
+// Release implements the `db.Snapshot` interface.
+func (snapshot *snapshot) Release() {
+	snapshot.snap.Release()
+}
@@ -0,0 +1,39 @@
+package leveldb
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// numStripes is the number of locks that keys are striped across.
+const numStripes = 64
+
+// stripes are the locks that keys are striped across. Every write to a key
+// holds the lock of its stripe, so that conditional writes can read, and then
+// write, a key without any other write to the key happening in between.
+// Batches and txns, which can write to any key, hold all of the locks.
+type stripes [numStripes]sync.Mutex
+
+// lock the stripe of the key, and return the function that unlocks it.
+func (stripes *stripes) lock(key string) func() {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	mu := &stripes[hash.Sum32()%numStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// lockAll locks all of the stripes. They are always locked in the same order,
+// so that concurrent calls cannot deadlock.
+func (stripes *stripes) lockAll() {
+	for i := range stripes {
+		stripes[i].Lock()
+	}
+}
+
+// unlockAll unlocks all of the stripes.
+func (stripes *stripes) unlockAll() {
+	for i := range stripes {
+		stripes[i].Unlock()
+	}
+}
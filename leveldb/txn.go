@@ -0,0 +1,397 @@
+package leveldb
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/renproject/kv/db"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// txn is a leveldb implementation of the `db.Txn`. Writes are buffered in the
+// txn, and written in one `leveldb.Batch` when it is committed, so committing
+// is as cheap as committing a batch. The txn holds all of the stripes of the
+// DB until it is done, and every other write to the DB holds at least one of
+// them, so the txn can never conflict with other writes, and it is atomic with
+// respect to conditional writes.
+//
+// A native `leveldb.Transaction` gives the same guarantees, because it also
+// blocks every other write until it is done, but committing one writes its
+// writes to a new level 0 table and triggers a compaction, however few writes
+// there are. Counted tables commit a txn for every insert, so native
+// transactions would overwhelm compaction.
+type txn struct {
+	ldb    *levelDB
+	writes map[string]write
+	done   bool
+}
+
+// write is a buffered insert, or delete, of a key in a txn.
+type write struct {
+	value  []byte
+	delete bool
+}
+
+// Get implements the `db.Txn` interface.
+func (txn *txn) Get(key string, value interface{}) error {
+	data, err := txn.get(key)
+	if err != nil {
+		return err
+	}
+	return txn.ldb.codec.Decode(data, value)
+}
+
+// Insert implements the `db.Txn` interface.
+func (txn *txn) Insert(key string, value interface{}) error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	data, err := txn.ldb.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	txn.writes[key] = write{value: data}
+	return nil
+}
+
+// Has implements the `db.Txn` interface.
+func (txn *txn) Has(key string) (bool, error) {
+	_, err := txn.get(key)
+	if err == db.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// InsertRaw implements the `db.Txn` interface.
+func (txn *txn) InsertRaw(key string, data []byte) error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	txn.writes[key] = write{value: append([]byte{}, data...)}
+	return nil
+}
+
+// GetRaw implements the `db.Txn` interface.
+func (txn *txn) GetRaw(key string) ([]byte, error) {
+	data, err := txn.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, data...), nil
+}
+
+// get returns the data associated with the key, observing the writes of the
+// txn. The data can be shared with the txn, so it must not be modified.
+func (txn *txn) get(key string) ([]byte, error) {
+	if txn.done {
+		return nil, db.ErrTxnDone
+	}
+	if key == "" {
+		return nil, db.ErrEmptyKey
+	}
+
+	if w, ok := txn.writes[key]; ok {
+		if w.delete {
+			return nil, db.ErrKeyNotFound
+		}
+		return w.value, nil
+	}
+	data, err := txn.ldb.db.Get([]byte(key), nil)
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	return data, nil
+}
+
+// Delete implements the `db.Txn` interface.
+func (txn *txn) Delete(key string) error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	txn.writes[key] = write{delete: true}
+	return nil
+}
+
+// Iterator implements the `db.Txn` interface. The writes of the txn are merged
+// into the key/value pairs of the DB as the iterator moves.
+func (txn *txn) Iterator(prefix string) db.Iterator {
+	var it iterator.Iterator
+	if txn.done {
+		it = iterator.NewEmptyIterator(db.ErrTxnDone)
+	} else {
+		it = txn.iterator(prefix)
+	}
+	return &iter{
+		ctx:    context.Background(),
+		prefix: []byte(prefix),
+		iter:   it,
+		codec:  txn.ldb.codec,
+	}
+}
+
+// iterator returns an iterator over the key/value pairs in the DB where the key
+// begins with the prefix, observing the writes of the txn.
+func (txn *txn) iterator(prefix string) iterator.Iterator {
+	hidden := db.HidesReserved(prefix)
+	writes := []keyedWrite{}
+	for key, w := range txn.writes {
+		if !strings.HasPrefix(key, prefix) || hidden && strings.HasPrefix(key, db.ReservedPrefix) {
+			continue
+		}
+		writes = append(writes, keyedWrite{key: []byte(key), write: w})
+	}
+	sort.Slice(writes, func(i, j int) bool {
+		return bytes.Compare(writes[i].key, writes[j].key) < 0
+	})
+	return &mergedIterator{
+		base:   hide(prefix, txn.ldb.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)),
+		writes: writes,
+	}
+}
+
+// Commit implements the `db.Txn` interface.
+func (txn *txn) Commit() error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	txn.done = true
+	defer txn.ldb.stripes.unlockAll()
+
+	if len(txn.writes) == 0 {
+		return nil
+	}
+	batch := new(leveldb.Batch)
+	for key, w := range txn.writes {
+		if w.delete {
+			batch.Delete([]byte(key))
+			continue
+		}
+		batch.Put([]byte(key), w.value)
+	}
+	return txn.ldb.db.Write(batch, nil)
+}
+
+// Discard implements the `db.Txn` interface.
+func (txn *txn) Discard() {
+	if txn.done {
+		return
+	}
+	txn.done = true
+	txn.ldb.stripes.unlockAll()
+}
+
+// keyedWrite is a buffered write of a txn together with its key.
+type keyedWrite struct {
+	key []byte
+	write
+}
+
+// position of a mergedIterator relative to its key/value pairs.
+type position int
+
+const (
+	beforeFirst position = iota
+	atPair
+	afterLast
+)
+
+// mergedIterator is an `iterator.Iterator` that merges the writes of a txn, in
+// lexicographic order of their keys, into the key/value pairs of a base
+// iterator over the DB. Writes replace the key/value pairs with the same key,
+// and deleted keys are skipped. When moving forward, the base iterator and the
+// index of the writes are at the first key that is greater than, or equal to,
+// the current key. When moving backward, they are at the last key that is less
+// than, or equal to, it.
+type mergedIterator struct {
+	base     iterator.Iterator
+	writes   []keyedWrite
+	index    int
+	backward bool
+
+	pos      position
+	key      []byte
+	value    []byte
+	buf      []byte
+	releaser util.Releaser
+}
+
+func (it *mergedIterator) First() bool {
+	it.base.First()
+	it.index = 0
+	it.backward = false
+	return it.settle()
+}
+
+func (it *mergedIterator) Last() bool {
+	it.base.Last()
+	it.index = len(it.writes) - 1
+	it.backward = true
+	return it.settle()
+}
+
+func (it *mergedIterator) Seek(key []byte) bool {
+	it.base.Seek(key)
+	it.index = it.search(key)
+	it.backward = false
+	return it.settle()
+}
+
+func (it *mergedIterator) Next() bool {
+	switch it.pos {
+	case beforeFirst:
+		return it.First()
+	case afterLast:
+		return false
+	}
+	if it.backward {
+		it.base.Seek(it.key)
+		it.index = it.search(it.key)
+		it.backward = false
+	}
+	if it.base.Valid() && bytes.Equal(it.base.Key(), it.key) {
+		it.base.Next()
+	}
+	if it.index < len(it.writes) && bytes.Equal(it.writes[it.index].key, it.key) {
+		it.index++
+	}
+	return it.settle()
+}
+
+func (it *mergedIterator) Prev() bool {
+	switch it.pos {
+	case afterLast:
+		return it.Last()
+	case beforeFirst:
+		return false
+	}
+	if !it.backward {
+		if it.base.Seek(it.key) {
+			it.base.Prev()
+		} else {
+			it.base.Last()
+		}
+		it.index = it.search(it.key) - 1
+		it.backward = true
+		return it.settle()
+	}
+	if it.base.Valid() && bytes.Equal(it.base.Key(), it.key) {
+		it.base.Prev()
+	}
+	if it.index >= 0 && bytes.Equal(it.writes[it.index].key, it.key) {
+		it.index--
+	}
+	return it.settle()
+}
+
+// settle moves the iterator to the key/value pair from the base iterator or
+// the writes that comes first in the direction of the iterator, skipping the
+// keys that have been deleted by the txn.
+func (it *mergedIterator) settle() bool {
+	for {
+		var w *keyedWrite
+		if it.index >= 0 && it.index < len(it.writes) {
+			w = &it.writes[it.index]
+		}
+		if !it.base.Valid() && w == nil {
+			it.key, it.value = nil, nil
+			if it.backward {
+				it.pos = beforeFirst
+			} else {
+				it.pos = afterLast
+			}
+			return false
+		}
+
+		// Compare the keys so that the key which comes first in the direction
+		// of the iterator is less than the other.
+		cmp := -1
+		if w != nil {
+			cmp = 1
+			if it.base.Valid() {
+				cmp = bytes.Compare(it.base.Key(), w.key)
+				if it.backward {
+					cmp = -cmp
+				}
+			}
+		}
+		if cmp < 0 {
+			// The key of the base iterator is only valid until it moves, but the
+			// current key is needed to move the base iterator.
+			it.buf = append(it.buf[:0], it.base.Key()...)
+			it.pos, it.key, it.value = atPair, it.buf, it.base.Value()
+			return true
+		}
+		if !w.delete {
+			it.pos, it.key, it.value = atPair, w.key, w.value
+			return true
+		}
+
+		// Skip the deleted key in both the base iterator and the writes.
+		if cmp == 0 {
+			if it.backward {
+				it.base.Prev()
+			} else {
+				it.base.Next()
+			}
+		}
+		if it.backward {
+			it.index--
+		} else {
+			it.index++
+		}
+	}
+}
+
+// search returns the index of the first write with a key that is greater
+// than, or equal to, the given key.
+func (it *mergedIterator) search(key []byte) int {
+	return sort.Search(len(it.writes), func(i int) bool {
+		return bytes.Compare(it.writes[i].key, key) >= 0
+	})
+}
+
+func (it *mergedIterator) Key() []byte {
+	return it.key
+}
+
+func (it *mergedIterator) Value() []byte {
+	return it.value
+}
+
+func (it *mergedIterator) Valid() bool {
+	return it.pos == atPair
+}
+
+func (it *mergedIterator) Error() error {
+	return it.base.Error()
+}
+
+func (it *mergedIterator) Release() {
+	it.base.Release()
+	it.pos, it.key, it.value = afterLast, nil, nil
+	if it.releaser != nil {
+		it.releaser.Release()
+		it.releaser = nil
+	}
+}
+
+func (it *mergedIterator) SetReleaser(releaser util.Releaser) {
+	it.releaser = releaser
+}
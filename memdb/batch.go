@@ -0,0 +1,80 @@
+package memdb
+
+import (
+	"strings"
+
+	"github.com/renproject/kv/db"
+)
+
+// write is a single insert, or delete, that is buffered in a batch.
+type write struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// batch is a in-memory implementation of the `db.Batch`. Writes are buffered
+// and applied while holding the write lock of the memdb, so readers never
+// observe a partially applied batch. Writes to the reserved key-space are
+// counted separately, so that they are not included in the length of the batch.
+type batch struct {
+	memdb    *memdb
+	writes   []write
+	reserved int
+}
+
+// Insert implements the `db.Batch` interface.
+func (batch *batch) Insert(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	data, err := batch.memdb.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	batch.writes = append(batch.writes, write{key: key, value: data})
+	batch.count(key)
+	return nil
+}
+
+// Delete implements the `db.Batch` interface.
+func (batch *batch) Delete(key string) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	batch.writes = append(batch.writes, write{key: key, delete: true})
+	batch.count(key)
+	return nil
+}
+
+// Len implements the `db.Batch` interface.
+func (batch *batch) Len() int {
+	return len(batch.writes) - batch.reserved
+}
+
+// count records a write to the key if it is in the reserved key-space.
+func (batch *batch) count(key string) {
+	if strings.HasPrefix(key, db.ReservedPrefix) {
+		batch.reserved++
+	}
+}
+
+// Commit implements the `db.Batch` interface.
+func (batch *batch) Commit() error {
+	batch.memdb.dataMu.Lock()
+	defer batch.memdb.dataMu.Unlock()
+
+	keys := make([]string, 0, len(batch.writes))
+	for _, w := range batch.writes {
+		keys = append(keys, w.key)
+		if w.delete {
+			batch.memdb.data = batch.memdb.data.Delete(w.key)
+			continue
+		}
+		batch.memdb.data = batch.memdb.data.Insert(w.key, w.value)
+	}
+	batch.memdb.written(keys...)
+	batch.writes = batch.writes[:0]
+	batch.reserved = 0
+	return nil
+}
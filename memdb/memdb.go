@@ -1,6 +1,7 @@
 package memdb
 
 import (
+	"context"
 	"strings"
 	"sync"
 
@@ -12,9 +13,18 @@ type memdb struct {
 	prefixMu *sync.Mutex
 	prefixes map[string]string
 
+	// data is ordered by key, so that iteration is in lexicographic order and
+	// only needs to visit the keys with a given prefix. It is never modified,
+	// only replaced, so it can be shared with snapshots and iterators.
 	dataMu *sync.RWMutex
-	data   map[string][]byte
+	data   *tree
 	codec  db.Codec
+
+	// seq is incremented on every write, and commits records the keys written
+	// since the oldest open txn was created. Both are guarded by the dataMu.
+	seq     uint64
+	txns    map[*txn]struct{}
+	commits []commit
 }
 
 // New returns a new memdb.
@@ -26,8 +36,9 @@ func New(codec db.Codec) db.DB {
 		prefixMu: new(sync.Mutex),
 		prefixes: map[string]string{},
 		dataMu:   new(sync.RWMutex),
-		data:     map[string][]byte{},
+		data:     newTree(),
 		codec:    codec,
+		txns:     map[*txn]struct{}{},
 	}
 }
 
@@ -38,6 +49,98 @@ func (memdb *memdb) Close() error {
 
 // Insert implements the `db.DB` interface.
 func (memdb *memdb) Insert(key string, value interface{}) error {
+	return memdb.InsertContext(context.Background(), key, value)
+}
+
+// Get implements the `db.DB` interface.
+func (memdb *memdb) Get(key string, value interface{}) error {
+	return memdb.GetContext(context.Background(), key, value)
+}
+
+// Delete implements the `db.DB` interface.
+func (memdb *memdb) Delete(key string) error {
+	return memdb.DeleteContext(context.Background(), key)
+}
+
+// Codec implements the `db.DB` interface.
+func (memdb *memdb) Codec() db.Codec {
+	return memdb.codec
+}
+
+// Has implements the `db.DB` interface.
+func (memdb *memdb) Has(key string) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	memdb.dataMu.RLock()
+	defer memdb.dataMu.RUnlock()
+
+	_, ok := memdb.data.Get(key)
+	return ok, nil
+}
+
+// InsertIfAbsent implements the `db.DB` interface.
+func (memdb *memdb) InsertIfAbsent(key string, value interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	data, err := memdb.codec.Encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	if _, ok := memdb.data.Get(key); ok {
+		return false, nil
+	}
+	memdb.data = memdb.data.Insert(key, data)
+	memdb.written(key)
+	return true, nil
+}
+
+// DeleteIfEquals implements the `db.DB` interface.
+func (memdb *memdb) DeleteIfEquals(key string, value interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	if ok, err := memdb.equals(key, value); !ok || err != nil {
+		return false, err
+	}
+	memdb.data = memdb.data.Delete(key)
+	memdb.written(key)
+	return true, nil
+}
+
+// CompareAndSwap implements the `db.DB` interface.
+func (memdb *memdb) CompareAndSwap(key string, old, new interface{}) (bool, error) {
+	if key == "" {
+		return false, db.ErrEmptyKey
+	}
+	data, err := memdb.codec.Encode(new)
+	if err != nil {
+		return false, err
+	}
+
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	if ok, err := memdb.equals(key, old); !ok || err != nil {
+		return false, err
+	}
+	memdb.data = memdb.data.Insert(key, data)
+	memdb.written(key)
+	return true, nil
+}
+
+// Merge implements the `db.DB` interface.
+func (memdb *memdb) Merge(key, name string, value interface{}) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
@@ -45,111 +148,510 @@ func (memdb *memdb) Insert(key string, value interface{}) error {
 	memdb.dataMu.Lock()
 	defer memdb.dataMu.Unlock()
 
-	data, err := memdb.codec.Encode(value)
+	existing, _ := memdb.data.Get(key)
+	data, err := db.MergeValue(memdb.codec, name, existing, value)
 	if err != nil {
 		return err
 	}
+	memdb.data = memdb.data.Insert(key, data)
+	memdb.written(key)
+	return nil
+}
 
-	memdb.data[key] = data
+// DeletePrefix implements the `db.DB` interface.
+func (memdb *memdb) DeletePrefix(prefix string) error {
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
 
+	var data *tree
+	var keys []string
+	if db.HidesReserved(prefix) {
+		// Delete the keys on either side of the reserved key-space.
+		reservedEnd, _ := prefixEnd(db.ReservedPrefix)
+		end, _ := prefixEnd(prefix)
+		var after []string
+		data, keys = memdb.data.DeleteRange(prefix, db.ReservedPrefix)
+		data, after = data.DeleteRange(reservedEnd, end)
+		keys = append(keys, after...)
+	} else {
+		data, keys = memdb.data.DeletePrefix(prefix)
+	}
+	if len(keys) > 0 {
+		memdb.data = data
+		memdb.written(keys...)
+	}
 	return nil
 }
 
-// Get implements the `db.DB` interface.
-func (memdb *memdb) Get(key string, value interface{}) error {
+// equals returns whether the value associated with the key is equal to the
+// given value. It must be called while holding the lock.
+func (memdb *memdb) equals(key string, value interface{}) (bool, error) {
+	data, ok := memdb.data.Get(key)
+	if !ok {
+		return false, nil
+	}
+	return db.EqualValue(memdb.codec, data, value)
+}
+
+// Size implements the `db.DB` interface.
+func (memdb *memdb) Size(prefix string) (int, error) {
+	return memdb.SizeContext(context.Background(), prefix)
+}
+
+// Stats implements the `db.DB` interface. The memdb does not use the disk, so
+// the disk bytes are the exact number of bytes used by the keys and values.
+func (memdb *memdb) Stats(prefix string) (db.Stats, error) {
+	memdb.dataMu.RLock()
+	defer memdb.dataMu.RUnlock()
+
+	stats := db.Stats{}
+	cursor := newTreeCursor(memdb.data, prefix, db.IteratorOptions{})
+	for ok := cursor.first(); ok; ok = cursor.next() {
+		n := cursor.path.node()
+		stats.Keys++
+		stats.KeyBytes += int64(len(n.key))
+		stats.ValueBytes += int64(len(n.value))
+	}
+	stats.DiskBytes = stats.KeyBytes + stats.ValueBytes
+	return stats, nil
+}
+
+// Iterator implements the `db.DB` interface.
+func (memdb *memdb) Iterator(prefix string) db.Iterator {
+	return memdb.IteratorContext(context.Background(), prefix, db.IteratorOptions{})
+}
+
+// IteratorWithOptions implements the `db.DB` interface.
+func (memdb *memdb) IteratorWithOptions(prefix string, opts db.IteratorOptions) db.Iterator {
+	return memdb.IteratorContext(context.Background(), prefix, opts)
+}
+
+// InsertContext implements the `db.DB` interface.
+func (memdb *memdb) InsertContext(ctx context.Context, key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := memdb.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	memdb.insert(key, data)
+	return nil
+}
+
+// GetContext implements the `db.DB` interface.
+func (memdb *memdb) GetContext(ctx context.Context, key string, value interface{}) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	memdb.dataMu.RLock()
 	defer memdb.dataMu.RUnlock()
 
-	data, ok := memdb.data[key]
+	data, ok := memdb.data.Get(key)
 	if !ok {
 		return db.ErrKeyNotFound
 	}
 	return memdb.codec.Decode(data, value)
 }
 
-// Delete implements the `db.DB` interface.
-func (memdb *memdb) Delete(key string) error {
+// DeleteContext implements the `db.DB` interface.
+func (memdb *memdb) DeleteContext(ctx context.Context, key string) error {
 	if key == "" {
 		return db.ErrEmptyKey
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	memdb.dataMu.Lock()
 	defer memdb.dataMu.Unlock()
 
-	delete(memdb.data, key)
+	memdb.data = memdb.data.Delete(key)
+	memdb.written(key)
 	return nil
 }
 
-// Size implements the `db.DB` interface.
-func (memdb *memdb) Size(prefix string) (int, error) {
+// SizeContext implements the `db.DB` interface.
+func (memdb *memdb) SizeContext(ctx context.Context, prefix string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
 	memdb.dataMu.RLock()
 	defer memdb.dataMu.RUnlock()
 
-	counter := 0
-	for key := range memdb.data {
-		if strings.HasPrefix(key, prefix) {
-			counter++
-		}
+	return size(memdb.data, prefix), nil
+}
+
+// IteratorContext implements the `db.DB` interface. The iterator reads the
+// data as it was when the iterator was created, so it is not affected by later
+// writes.
+func (memdb *memdb) IteratorContext(ctx context.Context, prefix string, opts db.IteratorOptions) db.Iterator {
+	memdb.dataMu.RLock()
+	data := memdb.data
+	memdb.dataMu.RUnlock()
+
+	return newIterator(ctx, data, prefix, opts, memdb.codec)
+}
+
+// InsertRaw implements the `db.DB` interface.
+func (memdb *memdb) InsertRaw(key string, data []byte) error {
+	if key == "" {
+		return db.ErrEmptyKey
 	}
-	return counter, nil
+	memdb.insert(key, append([]byte{}, data...))
+	return nil
 }
 
-// Iterator implements the `db.DB` interface.
-func (memdb *memdb) Iterator(prefix string) db.Iterator {
+// GetRaw implements the `db.DB` interface.
+func (memdb *memdb) GetRaw(key string) ([]byte, error) {
+	if key == "" {
+		return nil, db.ErrEmptyKey
+	}
+
 	memdb.dataMu.RLock()
 	defer memdb.dataMu.RUnlock()
 
-	iter := &iterator{
-		index:  -1,
-		codec:  memdb.codec,
-		keys:   make([]string, 0, len(memdb.data)),
-		values: make([][]byte, 0, len(memdb.data)),
+	data, ok := memdb.data.Get(key)
+	if !ok {
+		return nil, db.ErrKeyNotFound
 	}
-	for key, value := range memdb.data {
-		if strings.HasPrefix(key, prefix) {
-			iter.keys = append(iter.keys, strings.TrimPrefix(key, prefix))
-			iter.values = append(iter.values, value)
+	return append([]byte{}, data...), nil
+}
+
+// insert writes the encoded key/value pair into the data.
+func (memdb *memdb) insert(key string, data []byte) {
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	memdb.data = memdb.data.Insert(key, data)
+	memdb.written(key)
+}
+
+// NewBatch implements the `db.DB` interface.
+func (memdb *memdb) NewBatch() db.Batch {
+	return &batch{
+		memdb: memdb,
+	}
+}
+
+// NewTxn implements the `db.DB` interface.
+func (memdb *memdb) NewTxn() (db.Txn, error) {
+	memdb.dataMu.Lock()
+	defer memdb.dataMu.Unlock()
+
+	txn := &txn{
+		memdb:   memdb,
+		data:    memdb.data,
+		readSeq: memdb.seq,
+		reads:   map[string]struct{}{},
+		writes:  map[string]write{},
+	}
+	memdb.txns[txn] = struct{}{}
+	return txn, nil
+}
+
+// Snapshot implements the `db.DB` interface. The data is never modified, so it
+// is shared with the snapshot instead of being copied.
+func (memdb *memdb) Snapshot() (db.Snapshot, error) {
+	memdb.dataMu.RLock()
+	defer memdb.dataMu.RUnlock()
+
+	return &snapshot{
+		memdb: memdb,
+		data:  memdb.data,
+	}, nil
+}
+
+// written records that the given keys have been written, so that open txns
+// which have read any of them will conflict. It must be called while holding
+// the write lock.
+func (memdb *memdb) written(keys ...string) {
+	memdb.seq++
+	if len(memdb.txns) == 0 {
+		return
+	}
+	written := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		written[key] = struct{}{}
+	}
+	memdb.commits = append(memdb.commits, commit{seq: memdb.seq, keys: written})
+}
+
+// size returns the number of keys in the data that begin with the prefix.
+func size(data *tree, prefix string) int {
+	counter := 0
+	cursor := newTreeCursor(data, prefix, db.IteratorOptions{})
+	for ok := cursor.first(); ok; ok = cursor.next() {
+		counter++
+	}
+	return counter
+}
+
+// newIterator returns an iterator over the key/value pairs in the data where
+// the key begins with the prefix, and is in the range of the options. The
+// iterator walks the data lazily, so creating it and reading the first key/value
+// pairs does not depend on the size of the range. The iterator stops once the
+// context is done.
+func newIterator(ctx context.Context, data *tree, prefix string, opts db.IteratorOptions, codec db.Codec) *iterator {
+	return &iterator{
+		ctx:    ctx,
+		cursor: newTreeCursor(data, prefix, opts),
+		limit:  opts.Limit,
+		codec:  codec,
+	}
+}
+
+// newTreeCursor returns a cursor over the key/value pairs in the data where the
+// key begins with the prefix, and is in the range of the options.
+func newTreeCursor(data *tree, prefix string, opts db.IteratorOptions) *treeCursor {
+	cursor := &treeCursor{
+		data:    data,
+		prefix:  prefix,
+		lower:   prefix + opts.Start,
+		reverse: opts.Reverse,
+		hidden:  db.HidesReserved(prefix),
+	}
+	if opts.End != "" {
+		cursor.upper = prefix + opts.End
+	} else if upper, ok := prefixEnd(prefix); ok {
+		cursor.upper = upper
+	}
+	return cursor
+}
+
+// prefixEnd returns the smallest key that is greater than all keys that begin
+// with the prefix. It returns false if there is no such key.
+func prefixEnd(prefix string) (string, bool) {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1]), true
 		}
 	}
+	return "", false
+}
 
-	return iter
+// cursor moves over the key/value pairs of an iterator. The first and last
+// key/value pairs are the ones with the smallest and largest keys, and begin,
+// seek and next move in the order of iteration. Every move returns whether the
+// cursor is at a key/value pair.
+type cursor interface {
+	begin() bool
+	first() bool
+	last() bool
+	seek(key string) bool
+	next() bool
+	key() string
+	value() []byte
 }
 
-// iterator is a in-memory implementation of the `db.Iterator`.
-type iterator struct {
-	index int
-	codec db.Codec
+// treeCursor is a cursor over the key/value pairs of a tree where the key
+// begins with the prefix, and is in the range [lower, upper). An empty upper
+// bound leaves the range unbounded. If hidden is true, then the cursor skips
+// the keys in the reserved key-space. The tree is never modified, so the
+// cursor keeps the path to the node that it is at, and moves to the next node
+// by following the path.
+type treeCursor struct {
+	data    *tree
+	prefix  string
+	lower   string
+	upper   string
+	reverse bool
+	hidden  bool
 
-	keys   []string
-	values [][]byte
+	path path
+}
+
+func (cursor *treeCursor) begin() bool {
+	if cursor.reverse {
+		return cursor.last()
+	}
+	return cursor.first()
+}
+
+func (cursor *treeCursor) first() bool {
+	return cursor.move(cursor.data.seek(cursor.path, cursor.lower), true)
+}
+
+func (cursor *treeCursor) last() bool {
+	return cursor.move(cursor.end(), false)
+}
+
+func (cursor *treeCursor) seek(key string) bool {
+	key = cursor.prefix + key
+	if !cursor.reverse {
+		if key < cursor.lower {
+			key = cursor.lower
+		}
+		return cursor.move(cursor.data.seek(cursor.path, key), true)
+	}
+	if cursor.upper != "" && key >= cursor.upper {
+		return cursor.move(cursor.end(), false)
+	}
+	if p := cursor.data.seek(cursor.path, key); len(p) > 0 && p.node().key == key {
+		return cursor.move(p, false)
+	}
+	return cursor.move(cursor.data.seekBefore(cursor.path, key), false)
+}
+
+func (cursor *treeCursor) next() bool {
+	if cursor.reverse {
+		return cursor.move(cursor.path.prev(), false)
+	}
+	return cursor.move(cursor.path.next(), true)
+}
+
+func (cursor *treeCursor) key() string {
+	return strings.TrimPrefix(cursor.path.node().key, cursor.prefix)
+}
+
+func (cursor *treeCursor) value() []byte {
+	return cursor.path.node().value
+}
+
+// end returns the path to the node with the largest key in the range.
+func (cursor *treeCursor) end() path {
+	if cursor.upper == "" {
+		return cursor.data.last(cursor.path)
+	}
+	return cursor.data.seekBefore(cursor.path, cursor.upper)
+}
+
+// move moves the cursor to the end of the path, and returns whether the node
+// at the end of the path is in the range of the cursor. If the node is in the
+// reserved key-space, and the cursor skips it, then the cursor moves past the
+// reserved key-space in the given direction instead.
+func (cursor *treeCursor) move(p path, forward bool) bool {
+	if cursor.hidden && len(p) > 0 && strings.HasPrefix(p.node().key, db.ReservedPrefix) {
+		if forward {
+			reservedEnd, _ := prefixEnd(db.ReservedPrefix)
+			p = cursor.data.seek(p, reservedEnd)
+		} else {
+			p = cursor.data.seekBefore(p, db.ReservedPrefix)
+		}
+	}
+	cursor.path = p
+	if len(p) == 0 {
+		return false
+	}
+	n := p.node()
+	if n.key < cursor.lower || !strings.HasPrefix(n.key, cursor.prefix) {
+		return false
+	}
+	return cursor.upper == "" || n.key < cursor.upper
+}
+
+// iterator is a in-memory implementation of the `db.Iterator`. It moves a
+// cursor over its key/value pairs, and counts them towards its limit.
+type iterator struct {
+	ctx     context.Context
+	err     error
+	cursor  cursor
+	started bool
+	valid   bool
+	count   int
+	limit   int
+	codec   db.Codec
 }
 
 // Next implements the `db.Iterator` interface.
 func (iter *iterator) Next() bool {
-	iter.index++
-	return iter.index < len(iter.keys)
+	if iter.done() {
+		return false
+	}
+	iter.count++
+	switch {
+	case iter.limit > 0 && iter.count > iter.limit:
+		iter.valid = false
+	case !iter.started:
+		iter.started = true
+		iter.valid = iter.cursor.begin()
+	case iter.valid:
+		iter.valid = iter.cursor.next()
+	}
+	return iter.valid
+}
+
+// Seek implements the `db.Iterator` interface.
+func (iter *iterator) Seek(key string) bool {
+	return iter.move(func() bool {
+		return iter.cursor.seek(key)
+	})
+}
+
+// First implements the `db.Iterator` interface.
+func (iter *iterator) First() bool {
+	return iter.move(iter.cursor.first)
+}
+
+// Last implements the `db.Iterator` interface.
+func (iter *iterator) Last() bool {
+	return iter.move(iter.cursor.last)
+}
+
+// move moves the cursor, and resets the count of key/value pairs towards the
+// limit.
+func (iter *iterator) move(f func() bool) bool {
+	if iter.done() {
+		return false
+	}
+	iter.started = true
+	iter.count = 1
+	iter.valid = f()
+	return iter.valid
+}
+
+// done returns whether the context of the iterator is done, in which case the
+// iterator is no longer at a key/value pair.
+func (iter *iterator) done() bool {
+	if iter.err == nil {
+		iter.err = iter.ctx.Err()
+	}
+	if iter.err != nil {
+		iter.valid = false
+		return true
+	}
+	return false
 }
 
 // Key implements the `db.Iterator` interface.
 func (iter *iterator) Key() (string, error) {
-	if iter.index == -1 || iter.index >= len(iter.keys) {
+	if !iter.valid {
 		return "", db.ErrIndexOutOfRange
 	}
-
-	return iter.keys[iter.index], nil
+	return iter.cursor.key(), nil
 }
 
 // Value implements the `db.Iterator` interface.
 func (iter *iterator) Value(value interface{}) error {
-	if iter.index == -1 || iter.index >= len(iter.keys) {
+	if !iter.valid {
 		return db.ErrIndexOutOfRange
 	}
-	data := iter.values[iter.index]
-	return iter.codec.Decode(data, value)
+	return iter.codec.Decode(iter.cursor.value(), value)
+}
+
+// ValueBytes implements the `db.Iterator` interface.
+func (iter *iterator) ValueBytes() ([]byte, error) {
+	if !iter.valid {
+		return nil, db.ErrIndexOutOfRange
+	}
+	return append([]byte{}, iter.cursor.value()...), nil
+}
+
+// Err implements the `db.Iterator` interface. Reading from memory never fails,
+// so the only errors are the error of the context, and ErrTxnDone.
+func (iter *iterator) Err() error {
+	return iter.err
 }
 
 // Close implements the `db.Iterator` interface.
@@ -3,7 +3,9 @@ package memdb_test
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"reflect"
+	"sort"
 	"testing/quick"
 
 	. "github.com/onsi/ginkgo"
@@ -194,6 +196,207 @@ var _ = Describe("im-memory implementation of the db", func() {
 				})
 			})
 		})
+
+		Context("when committing a txn that read a key which has since been modified", func() {
+			It("should return ErrConflict and not write anything", func() {
+				memdb := New(codec)
+				defer memdb.Close()
+
+				test := func(key string, value, other testutil.TestStruct) bool {
+					if key == "" {
+						return true
+					}
+
+					txn, err := memdb.NewTxn()
+					Expect(err).NotTo(HaveOccurred())
+					defer txn.Discard()
+
+					stored := testutil.TestStruct{D: []byte{}}
+					Expect(txn.Get(key, &stored)).Should(Equal(db.ErrKeyNotFound))
+					Expect(txn.Insert(key, value)).Should(Succeed())
+
+					// Modify the key outside of the txn after it has been read.
+					Expect(memdb.Insert(key, other)).Should(Succeed())
+					Expect(txn.Commit()).Should(Equal(db.ErrConflict))
+
+					stored = testutil.TestStruct{D: []byte{}}
+					Expect(memdb.Get(key, &stored)).Should(Succeed())
+					Expect(reflect.DeepEqual(stored, other)).Should(BeTrue())
+					Expect(memdb.Delete(key)).Should(Succeed())
+					return true
+				}
+
+				Expect(quick.Check(test, &quick.Config{MaxCount: 20})).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when reading keys in a txn that are written outside of it", func() {
+			It("should read the keys as they were when the txn was created", func() {
+				memdb := New(codec)
+				defer memdb.Close()
+
+				Expect(memdb.Insert("a", uint64(1))).Should(Succeed())
+				Expect(memdb.Insert("b", uint64(1))).Should(Succeed())
+
+				txn, err := memdb.NewTxn()
+				Expect(err).NotTo(HaveOccurred())
+				defer txn.Discard()
+
+				var a, b uint64
+				Expect(txn.Get("a", &a)).Should(Succeed())
+				Expect(memdb.Insert("a", uint64(2))).Should(Succeed())
+				Expect(memdb.Insert("b", uint64(2))).Should(Succeed())
+				Expect(memdb.Insert("c", uint64(2))).Should(Succeed())
+				Expect(txn.Get("b", &b)).Should(Succeed())
+				Expect(a).Should(Equal(uint64(1)))
+				Expect(b).Should(Equal(uint64(1)))
+
+				iter := txn.Iterator("")
+				defer iter.Close()
+				keys := []string{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					keys = append(keys, key)
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				Expect(keys).Should(Equal([]string{"a", "b"}))
+				Expect(txn.Commit()).Should(Succeed())
+			})
+		})
+
+		Context("when iterating over a txn with buffered writes", func() {
+			It("should merge the writes into the key/value pairs in order", func() {
+				memdb := New(codec)
+				defer memdb.Close()
+
+				for _, key := range []string{"p_a", "p_c", "p_e", "q_a"} {
+					Expect(memdb.Insert(key, uint64(1))).Should(Succeed())
+				}
+				txn, err := memdb.NewTxn()
+				Expect(err).NotTo(HaveOccurred())
+				defer txn.Discard()
+				Expect(txn.Insert("p_b", uint64(2))).Should(Succeed())
+				Expect(txn.Insert("p_c", uint64(2))).Should(Succeed())
+				Expect(txn.Delete("p_e")).Should(Succeed())
+				Expect(txn.Insert("q_b", uint64(2))).Should(Succeed())
+
+				iter := txn.Iterator("p_")
+				defer iter.Close()
+				pairs := map[string]uint64{}
+				keys := []string{}
+				for iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					var value uint64
+					Expect(iter.Value(&value)).Should(Succeed())
+					keys = append(keys, key)
+					pairs[key] = value
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				Expect(keys).Should(Equal([]string{"a", "b", "c"}))
+				Expect(pairs).Should(Equal(map[string]uint64{"a": 1, "b": 2, "c": 2}))
+
+				Expect(iter.Last()).Should(BeTrue())
+				key, err := iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(Equal("c"))
+				Expect(iter.Next()).Should(BeFalse())
+
+				Expect(iter.Seek("b")).Should(BeTrue())
+				key, err = iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(Equal("b"))
+				Expect(iter.Next()).Should(BeTrue())
+				key, err = iter.Key()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).Should(Equal("c"))
+			})
+		})
+
+		Context("when writing to the db while iterating", func() {
+			It("should only return the keys that existed when the iterator was created", func() {
+				memdb := New(codec)
+				defer memdb.Close()
+
+				Expect(memdb.Insert("p_a", uint64(1))).Should(Succeed())
+				Expect(memdb.Insert("p_c", uint64(3))).Should(Succeed())
+
+				iter := memdb.Iterator("p_")
+				defer iter.Close()
+				Expect(iter.Next()).Should(BeTrue())
+				Expect(memdb.Insert("p_b", uint64(2))).Should(Succeed())
+				Expect(memdb.Delete("p_c")).Should(Succeed())
+
+				keys := []string{}
+				for ok := true; ok; ok = iter.Next() {
+					key, err := iter.Key()
+					Expect(err).NotTo(HaveOccurred())
+					keys = append(keys, key)
+				}
+				Expect(iter.Err()).NotTo(HaveOccurred())
+				Expect(keys).Should(Equal([]string{"a", "c"}))
+			})
+
+			It("should keep every iterator at the keys that existed when it was created", func() {
+				memdb := New(codec)
+				defer memdb.Close()
+
+				// Write random keys, and keep an iterator open after each round of
+				// writes, so that every iterator shares its data with later writes.
+				expected := map[string]uint64{}
+				iters := []db.Iterator{}
+				snapshots := [][]string{}
+				for round := 0; round < 20; round++ {
+					for i := 0; i < 50; i++ {
+						key := fmt.Sprintf("%03d", rand.Intn(200))
+						switch rand.Intn(10) {
+						case 0:
+							Expect(memdb.DeletePrefix(key[:2])).Should(Succeed())
+							for k := range expected {
+								if k[:2] == key[:2] {
+									delete(expected, k)
+								}
+							}
+						case 1, 2, 3:
+							Expect(memdb.Delete(key)).Should(Succeed())
+							delete(expected, key)
+						default:
+							Expect(memdb.Insert(key, uint64(i))).Should(Succeed())
+							expected[key] = uint64(i)
+						}
+					}
+
+					keys := make([]string, 0, len(expected))
+					for k := range expected {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					size, err := memdb.Size("")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(size).Should(Equal(len(keys)))
+
+					iters = append(iters, memdb.IteratorWithOptions("", db.IteratorOptions{Reverse: round%2 == 1}))
+					snapshots = append(snapshots, keys)
+				}
+
+				for i, iter := range iters {
+					keys := []string{}
+					for iter.Next() {
+						key, err := iter.Key()
+						Expect(err).NotTo(HaveOccurred())
+						keys = append(keys, key)
+					}
+					Expect(iter.Err()).NotTo(HaveOccurred())
+					iter.Close()
+
+					if i%2 == 1 {
+						sort.Sort(sort.Reverse(sort.StringSlice(snapshots[i])))
+					}
+					Expect(keys).Should(Equal(snapshots[i]))
+				}
+			})
+		})
 	}
 
 	Context("when initializing the db with a nil codec", func() {
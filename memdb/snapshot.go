@@ -0,0 +1,42 @@
+package memdb
+
+import (
+	"context"
+
+	"github.com/renproject/kv/db"
+)
+
+// snapshot is a in-memory implementation of the `db.Snapshot`. It shares the
+// data of the memdb at the time it was taken. The data is never modified, so
+// the snapshot does not need to hold any locks.
+type snapshot struct {
+	memdb *memdb
+	data  *tree
+}
+
+// Get implements the `db.Snapshot` interface.
+func (snapshot *snapshot) Get(key string, value interface{}) error {
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	data, ok := snapshot.data.Get(key)
+	if !ok {
+		return db.ErrKeyNotFound
+	}
+	return snapshot.memdb.codec.Decode(data, value)
+}
+
+// Size implements the `db.Snapshot` interface.
+func (snapshot *snapshot) Size(prefix string) (int, error) {
+	return size(snapshot.data, prefix), nil
+}
+
+// Iterator implements the `db.Snapshot` interface.
+func (snapshot *snapshot) Iterator(prefix string) db.Iterator {
+	return newIterator(context.Background(), snapshot.data, prefix, db.IteratorOptions{}, snapshot.memdb.codec)
+}
+
+// Release implements the `db.Snapshot` interface. The snapshot does not hold
+// any resources, so there is nothing to release.
+func (snapshot *snapshot) Release() {}
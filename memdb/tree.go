@@ -0,0 +1,281 @@
+package memdb
+
+import "math/rand"
+
+// node is a key/value pair in a tree. Nodes are never modified once they are
+// part of a tree, so they can be shared between trees.
+type node struct {
+	key      string
+	value    []byte
+	priority uint64
+	left     *node
+	right    *node
+}
+
+// tree is a persistent ordered map from keys to values, implemented as a treap.
+// A tree is never modified. Writes return a new tree that shares every node
+// that is not on the path to the written keys, so taking a snapshot of a tree
+// takes O(1) time, and the snapshot can be read without holding any locks.
+// Lookups, inserts and deletes take O(log n) expected time, and the key/value
+// pairs can be traversed in lexicographic order of their keys.
+type tree struct {
+	root   *node
+	length int
+}
+
+// newTree returns an empty tree.
+func newTree() *tree {
+	return &tree{}
+}
+
+// Len returns the number of key/value pairs in the tree.
+func (t *tree) Len() int {
+	return t.length
+}
+
+// Get the value associated with the key.
+func (t *tree) Get(key string) ([]byte, bool) {
+	n := t.root
+	for n != nil {
+		switch {
+		case key < n.key:
+			n = n.left
+		case key > n.key:
+			n = n.right
+		default:
+			return n.value, true
+		}
+	}
+	return nil, false
+}
+
+// Insert returns a tree with the key/value pair inserted into it, replacing
+// the existing value if the key already exists.
+func (t *tree) Insert(key string, value []byte) *tree {
+	if _, ok := t.Get(key); ok {
+		return &tree{root: replace(t.root, key, value), length: t.length}
+	}
+	inserted := &node{key: key, value: value, priority: rand.Uint64()}
+	return &tree{root: insert(t.root, inserted), length: t.length + 1}
+}
+
+// Delete returns a tree without the key.
+func (t *tree) Delete(key string) *tree {
+	if _, ok := t.Get(key); !ok {
+		return t
+	}
+	return &tree{root: remove(t.root, key), length: t.length - 1}
+}
+
+// DeletePrefix returns a tree without any of the keys that begin with the
+// given prefix, and the keys that were deleted.
+func (t *tree) DeletePrefix(prefix string) (*tree, []string) {
+	end, _ := prefixEnd(prefix)
+	return t.DeleteRange(prefix, end)
+}
+
+// DeleteRange returns a tree without any of the keys in the range [start, end),
+// and the keys that were deleted. An empty end leaves the range unbounded. The
+// keys are adjacent, so they are split from the tree at once instead of being
+// deleted one at a time.
+func (t *tree) DeleteRange(start, end string) (*tree, []string) {
+	left, deleted := split(t.root, start)
+	var right *node
+	if end != "" {
+		deleted, right = split(deleted, end)
+	}
+
+	var keys []string
+	walk(deleted, func(n *node) {
+		keys = append(keys, n.key)
+	})
+	if len(keys) == 0 {
+		return t, nil
+	}
+	return &tree{root: merge(left, right), length: t.length - len(keys)}, keys
+}
+
+// path is the sequence of nodes from the root of a tree to a node, so that
+// moving to the next, or previous, node takes O(1) amortised time. An empty
+// path is not at any node.
+type path []*node
+
+// node returns the node that the path leads to.
+func (p path) node() *node {
+	return p[len(p)-1]
+}
+
+// next returns the path to the node with the next key.
+func (p path) next() path {
+	n := p.node()
+	if n.right != nil {
+		for n = n.right; n != nil; n = n.left {
+			p = append(p, n)
+		}
+		return p
+	}
+	for len(p) > 1 {
+		child := p.node()
+		p = p[:len(p)-1]
+		if p.node().left == child {
+			return p
+		}
+	}
+	return p[:0]
+}
+
+// prev returns the path to the node with the previous key.
+func (p path) prev() path {
+	n := p.node()
+	if n.left != nil {
+		for n = n.left; n != nil; n = n.right {
+			p = append(p, n)
+		}
+		return p
+	}
+	for len(p) > 1 {
+		child := p.node()
+		p = p[:len(p)-1]
+		if p.node().right == child {
+			return p
+		}
+	}
+	return p[:0]
+}
+
+// seek returns the path to the first node with a key that is greater than, or
+// equal to, the given key. The path reuses the memory of the given path.
+func (t *tree) seek(p path, key string) path {
+	p, depth := p[:0], 0
+	for n := t.root; n != nil; {
+		p = append(p, n)
+		if n.key >= key {
+			depth = len(p)
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return p[:depth]
+}
+
+// seekBefore returns the path to the last node with a key that is less than
+// the given key. The path reuses the memory of the given path.
+func (t *tree) seekBefore(p path, key string) path {
+	p, depth := p[:0], 0
+	for n := t.root; n != nil; {
+		p = append(p, n)
+		if n.key < key {
+			depth = len(p)
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return p[:depth]
+}
+
+// last returns the path to the node with the largest key. The path reuses the
+// memory of the given path.
+func (t *tree) last(p path) path {
+	p = p[:0]
+	for n := t.root; n != nil; n = n.right {
+		p = append(p, n)
+	}
+	return p
+}
+
+// insert returns a copy of the subtree with the node inserted into it. The key
+// of the node must not already be in the subtree.
+func insert(n, inserted *node) *node {
+	if n == nil {
+		return inserted
+	}
+	if inserted.priority > n.priority {
+		inserted.left, inserted.right = split(n, inserted.key)
+		return inserted
+	}
+	copied := *n
+	if inserted.key < n.key {
+		copied.left = insert(n.left, inserted)
+	} else {
+		copied.right = insert(n.right, inserted)
+	}
+	return &copied
+}
+
+// replace returns a copy of the subtree with the value of the key replaced.
+// The key must already be in the subtree.
+func replace(n *node, key string, value []byte) *node {
+	copied := *n
+	switch {
+	case key < n.key:
+		copied.left = replace(n.left, key, value)
+	case key > n.key:
+		copied.right = replace(n.right, key, value)
+	default:
+		copied.value = value
+	}
+	return &copied
+}
+
+// remove returns a copy of the subtree without the key. The key must already
+// be in the subtree.
+func remove(n *node, key string) *node {
+	copied := *n
+	switch {
+	case key < n.key:
+		copied.left = remove(n.left, key)
+	case key > n.key:
+		copied.right = remove(n.right, key)
+	default:
+		return merge(n.left, n.right)
+	}
+	return &copied
+}
+
+// split returns copies of the subtree with the keys that are less than the
+// given key, and with the keys that are greater than, or equal to, it.
+func split(n *node, key string) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+	copied := *n
+	if n.key < key {
+		left, right := split(n.right, key)
+		copied.right = left
+		return &copied, right
+	}
+	left, right := split(n.left, key)
+	copied.left = right
+	return left, &copied
+}
+
+// merge returns a subtree with the keys of both subtrees. Every key in the left
+// subtree must be less than every key in the right subtree.
+func merge(left, right *node) *node {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	if left.priority > right.priority {
+		copied := *left
+		copied.right = merge(left.right, right)
+		return &copied
+	}
+	copied := *right
+	copied.left = merge(left, right.left)
+	return &copied
+}
+
+// walk calls the function on every node in the subtree, in lexicographic
+// order of their keys.
+func walk(n *node, f func(n *node)) {
+	for n != nil {
+		walk(n.left, f)
+		f(n)
+		n = n.right
+	}
+}
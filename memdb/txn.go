@@ -0,0 +1,331 @@
+package memdb
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/renproject/kv/db"
+)
+
+// commit is the set of keys written by a single write to the memdb.
+type commit struct {
+	seq  uint64
+	keys map[string]struct{}
+}
+
+// txn is a in-memory implementation of the `db.Txn`. Reads go to the data of
+// the memdb as it was when the txn was created, so every read of the txn is
+// consistent, and writes are buffered until the txn is committed. Conflicts
+// are detected optimistically: committing fails if any key read by the txn has
+// been written since the txn was created.
+type txn struct {
+	memdb   *memdb
+	data    *tree
+	readSeq uint64
+	reads   map[string]struct{}
+	writes  map[string]write
+	done    bool
+}
+
+// Get implements the `db.Txn` interface.
+func (txn *txn) Get(key string, value interface{}) error {
+	data, err := txn.get(key)
+	if err != nil {
+		return err
+	}
+	return txn.memdb.codec.Decode(data, value)
+}
+
+// Has implements the `db.Txn` interface.
+func (txn *txn) Has(key string) (bool, error) {
+	_, err := txn.get(key)
+	if err == db.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetRaw implements the `db.Txn` interface.
+func (txn *txn) GetRaw(key string) ([]byte, error) {
+	data, err := txn.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, data...), nil
+}
+
+// get returns the data associated with the key, observing the writes of the
+// txn, and records that the key has been read by the txn. The data is shared,
+// so it must not be modified.
+func (txn *txn) get(key string) ([]byte, error) {
+	if txn.done {
+		return nil, db.ErrTxnDone
+	}
+	if key == "" {
+		return nil, db.ErrEmptyKey
+	}
+
+	if w, ok := txn.writes[key]; ok {
+		if w.delete {
+			return nil, db.ErrKeyNotFound
+		}
+		return w.value, nil
+	}
+
+	data, ok := txn.data.Get(key)
+	txn.reads[key] = struct{}{}
+	if !ok {
+		return nil, db.ErrKeyNotFound
+	}
+	return data, nil
+}
+
+// Insert implements the `db.Txn` interface.
+func (txn *txn) Insert(key string, value interface{}) error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	data, err := txn.memdb.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	txn.writes[key] = write{key: key, value: data}
+	return nil
+}
+
+// InsertRaw implements the `db.Txn` interface.
+func (txn *txn) InsertRaw(key string, data []byte) error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	txn.writes[key] = write{key: key, value: append([]byte{}, data...)}
+	return nil
+}
+
+// Delete implements the `db.Txn` interface.
+func (txn *txn) Delete(key string) error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+	if key == "" {
+		return db.ErrEmptyKey
+	}
+
+	txn.writes[key] = write{key: key, delete: true}
+	return nil
+}
+
+// Iterator implements the `db.Txn` interface. The writes of the txn are merged
+// into the key/value pairs of the data as the iterator moves, and every key of
+// the data that is returned by the iterator is read by the txn.
+func (txn *txn) Iterator(prefix string) db.Iterator {
+	iter := &iterator{
+		ctx:   context.Background(),
+		codec: txn.memdb.codec,
+	}
+	if txn.done {
+		iter.cursor = &txnCursor{}
+		iter.err = db.ErrTxnDone
+		return iter
+	}
+
+	hidden := db.HidesReserved(prefix)
+	writes := []write{}
+	for key, w := range txn.writes {
+		if !strings.HasPrefix(key, prefix) || hidden && strings.HasPrefix(key, db.ReservedPrefix) {
+			continue
+		}
+		writes = append(writes, w)
+	}
+	sort.Slice(writes, func(i, j int) bool {
+		return writes[i].key < writes[j].key
+	})
+	iter.cursor = &txnCursor{
+		txn:    txn,
+		data:   newTreeCursor(txn.data, prefix, db.IteratorOptions{}),
+		prefix: prefix,
+		writes: writes,
+	}
+	return iter
+}
+
+// Commit implements the `db.Txn` interface.
+func (txn *txn) Commit() error {
+	if txn.done {
+		return db.ErrTxnDone
+	}
+
+	txn.memdb.dataMu.Lock()
+	defer txn.memdb.dataMu.Unlock()
+	defer txn.close()
+
+	if len(txn.writes) == 0 {
+		return nil
+	}
+	for _, commit := range txn.memdb.commits {
+		if commit.seq <= txn.readSeq {
+			continue
+		}
+		for key := range commit.keys {
+			if _, ok := txn.reads[key]; ok {
+				return db.ErrConflict
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(txn.writes))
+	for key, w := range txn.writes {
+		keys = append(keys, key)
+		if w.delete {
+			txn.memdb.data = txn.memdb.data.Delete(key)
+			continue
+		}
+		txn.memdb.data = txn.memdb.data.Insert(key, w.value)
+	}
+	txn.memdb.written(keys...)
+	return nil
+}
+
+// Discard implements the `db.Txn` interface.
+func (txn *txn) Discard() {
+	if txn.done {
+		return
+	}
+
+	txn.memdb.dataMu.Lock()
+	defer txn.memdb.dataMu.Unlock()
+
+	txn.close()
+}
+
+// close marks the txn as done and forgets any commits that can no longer
+// conflict with an open txn. It must be called while holding the write lock.
+func (txn *txn) close() {
+	txn.done = true
+	delete(txn.memdb.txns, txn)
+
+	if len(txn.memdb.txns) == 0 {
+		txn.memdb.commits = nil
+		return
+	}
+	oldest := txn.memdb.seq
+	for other := range txn.memdb.txns {
+		if other.readSeq < oldest {
+			oldest = other.readSeq
+		}
+	}
+	i := 0
+	for i < len(txn.memdb.commits) && txn.memdb.commits[i].seq <= oldest {
+		i++
+	}
+	txn.memdb.commits = txn.memdb.commits[i:]
+}
+
+// txnCursor is a forward cursor that merges the writes of a txn, in
+// lexicographic order of their keys, into the key/value pairs of the data of
+// the txn. Each move consumes the next key/value pair from the data or the
+// writes, so the data cursor and the index of the writes are always after the
+// key/value pair that the cursor is at.
+type txnCursor struct {
+	txn    *txn
+	data   *treeCursor
+	prefix string
+	writes []write
+
+	valid   bool
+	index   int
+	current write
+}
+
+func (cursor *txnCursor) begin() bool {
+	return cursor.first()
+}
+
+func (cursor *txnCursor) first() bool {
+	cursor.valid = cursor.data.first()
+	cursor.index = 0
+	return cursor.consume()
+}
+
+func (cursor *txnCursor) last() bool {
+	// Find the largest key that has not been deleted by the txn, and seek to
+	// it, so that the cursor can move forward from there.
+	back := newTreeCursor(cursor.data.data, cursor.prefix, db.IteratorOptions{Reverse: true})
+	ok := back.begin()
+	for i := len(cursor.writes) - 1; i >= 0; i-- {
+		w := cursor.writes[i]
+		if ok && back.path.node().key > w.key {
+			break
+		}
+		if ok && back.path.node().key == w.key {
+			ok = back.next()
+		}
+		if !w.delete {
+			return cursor.seek(strings.TrimPrefix(w.key, cursor.prefix))
+		}
+	}
+	if !ok {
+		cursor.valid, cursor.index = false, len(cursor.writes)
+		return false
+	}
+	return cursor.seek(back.key())
+}
+
+func (cursor *txnCursor) seek(key string) bool {
+	cursor.valid = cursor.data.seek(key)
+	cursor.index = sort.Search(len(cursor.writes), func(i int) bool {
+		return cursor.writes[i].key >= cursor.prefix+key
+	})
+	return cursor.consume()
+}
+
+func (cursor *txnCursor) next() bool {
+	return cursor.consume()
+}
+
+func (cursor *txnCursor) key() string {
+	return strings.TrimPrefix(cursor.current.key, cursor.prefix)
+}
+
+func (cursor *txnCursor) value() []byte {
+	return cursor.current.value
+}
+
+// consume moves the cursor to the next key/value pair from the data or the
+// writes, whichever has the smaller key. Writes replace the key/value pairs of
+// the data with the same key, and deleted keys are skipped.
+func (cursor *txnCursor) consume() bool {
+	for {
+		hasWrite := cursor.index < len(cursor.writes)
+		if !cursor.valid && !hasWrite {
+			return false
+		}
+		if cursor.valid {
+			n := cursor.data.path.node()
+			if !hasWrite || n.key < cursor.writes[cursor.index].key {
+				cursor.txn.reads[n.key] = struct{}{}
+				cursor.current = write{key: n.key, value: n.value}
+				cursor.valid = cursor.data.next()
+				return true
+			}
+			if n.key == cursor.writes[cursor.index].key {
+				cursor.valid = cursor.data.next()
+			}
+		}
+		w := cursor.writes[cursor.index]
+		cursor.index++
+		if !w.delete {
+			cursor.current = w
+			return true
+		}
+	}
+}